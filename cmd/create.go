@@ -9,30 +9,25 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"time"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/progress"
 	"chain4travel.com/camktncr/pkg/version1"
 	"chain4travel.com/camktncr/pkg/version1/k8s"
 	"github.com/spf13/cobra"
-	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func init() {
-	createCmd.Flags().Uint64("api-nodes", 2, "number of api-nodes")
-	createCmd.Flags().Uint64("validators", 5, "number of validators to create (cannot be higher than the initial generated number)")
-	createCmd.Flags().String("validator-ram", "1Gi", "ram of the validators")
-	createCmd.Flags().String("validator-cpu", "500m", "cpu of the validators")
-	createCmd.Flags().String("api-nodes-ram", "1Gi", "ram of the api-nodes")
-	createCmd.Flags().String("api-nodes-cpu", "500m", "cpu of the api-nodes")
-	createCmd.Flags().String("tls-secret-name", "kopernikus.camino.foundation-ingress-tls", "tls secret located in default namespace")
-	createCmd.Flags().String("pull-secret-name", "gcr-image-pull", "pull secret located in default namespace")
-	createCmd.Flags().String("image", "europe-west3-docker.pkg.dev/pwk-c4t-dev/internal-camino-dev/camino-node:tiedemann-64de0a0003bfab988da62850eef37ef01f82fdad-1668765791", "docker image to run the nodes")
-	createCmd.Flags().String("domain", "camino.network", "under which domain to publish the network api nodes")
+	addNetworkFlags(createCmd)
 	createCmd.Flags().DurationP("timeout", "t", 0, "stop execution after this time (non negative and 0 means no timeout)")
-	createCmd.Flags().Bool("enable-monitoring", true, "toggle the creation of service monitors")
-	createCmd.Flags().BoolP("ignore-version-check", "c", false, "toggle the creation of service monitors")
+	createCmd.Flags().Duration("ttl", 0, "garbage collect the network after this time, see k8s gc (0 means never)")
+	createCmd.Flags().Bool("force", false, "reuse the namespace even if it was not created for this network file")
+	createCmd.Flags().Bool("bootstrap-job", false, "register the validators from a job inside the cluster instead of from this process")
+	createCmd.Flags().String("bootstrap-image", "", "camktncr image the bootstrap job runs (required with --bootstrap-job)")
 }
 
 var createCmd = &cobra.Command{
@@ -48,77 +43,38 @@ var createCmd = &cobra.Command{
 			return err
 		}
 
-		image, err := cmd.Flags().GetString("image")
+		connection, err := cmd.Flags().GetString("connection")
 		if err != nil {
 			return err
 		}
-
-		domain, err := cmd.Flags().GetString("domain")
+		connectionMode, err := k8s.ParseConnectionMode(connection)
 		if err != nil {
 			return err
 		}
 
-		validatorCpu, err := cmd.Flags().GetString("validator-cpu")
-		if err != nil {
-			return err
-		}
-		validatorRam, err := cmd.Flags().GetString("validator-ram")
-		if err != nil {
-			return err
-		}
-		apiCpu, err := cmd.Flags().GetString("api-nodes-cpu")
-		if err != nil {
-			return err
-		}
-		apiRam, err := cmd.Flags().GetString("api-nodes-ram")
+		bootstrapJob, err := cmd.Flags().GetBool("bootstrap-job")
 		if err != nil {
 			return err
 		}
-
-		tlsSecretName, err := cmd.Flags().GetString("tls-secret-name")
+		bootstrapImage, err := cmd.Flags().GetString("bootstrap-image")
 		if err != nil {
 			return err
 		}
-
-		pullSecretName, err := cmd.Flags().GetString("pull-secret-name")
-		if err != nil {
-			return err
+		if bootstrapJob && bootstrapImage == "" {
+			return fmt.Errorf("--bootstrap-job requires a --bootstrap-image")
 		}
 
-		enableMonitoring, err := cmd.Flags().GetBool("enable-monitoring")
+		force, err := cmd.Flags().GetBool("force")
 		if err != nil {
 			return err
 		}
 
-		k8sConfig := version1.K8sConfig{
-			K8sPrefix: networkName,
-			Namespace: networkName,
-			Labels: map[string]string{
-				"network": networkName,
-			},
-			Image:          image,
-			Domain:         domain,
-			TLSSecretName:  tlsSecretName,
-			PullSecretName: pullSecretName,
-			Resources: version1.K8sResources{
-				Api: v1.ResourceList{
-					v1.ResourceCPU:    resource.MustParse(apiCpu),
-					v1.ResourceMemory: resource.MustParse(apiRam),
-				},
-				Validator: v1.ResourceList{
-					v1.ResourceCPU:    resource.MustParse(validatorCpu),
-					v1.ResourceMemory: resource.MustParse(validatorRam),
-				},
-			},
-			EnableMonitoring: enableMonitoring,
-		}
-
-		numValidators, err := cmd.Flags().GetUint64("validators")
+		ttl, err := cmd.Flags().GetDuration("ttl")
 		if err != nil {
 			return err
 		}
 
-		numApiNodes, err := cmd.Flags().GetUint64("api-nodes")
+		k8sConfig, err := k8sConfigFromFlags(cmd, networkName)
 		if err != nil {
 			return err
 		}
@@ -129,7 +85,9 @@ var createCmd = &cobra.Command{
 		}
 		ctx := cmd.Context()
 		if timeoutDur > 0 {
-			ctx, _ = context.WithTimeout(ctx, timeoutDur)
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeoutDur)
+			defer cancel()
 		}
 
 		kRest, k, err := pkg.InitClientSet(kubeconfig)
@@ -137,104 +95,97 @@ var createCmd = &cobra.Command{
 			return err
 		}
 
-		network, err := version1.LoadNetwork(fmt.Sprintf("%s.json", networkName))
-		if err != nil {
-			return err
-		}
-
-		ignoreVersion, err := cmd.Flags().GetBool("ignore-version-check")
+		spec, err := loadNetworkSpec(cmd, networkName)
 		if err != nil {
 			return err
 		}
+		network := spec.Network
+		numValidators := spec.NumValidators
+		numApiNodes := spec.NumApiNodes
+		numInitialStakers := spec.NumInitialStakers
 
-		if !ignoreVersion {
-
-			if network.Version == "" {
-				return fmt.Errorf("using old network json, please regenerate")
-			}
-
-			if network.Version != pkg.Commit {
-				return fmt.Errorf("cannot create network with different version, please checkout this commit and use that version to create the network: %s", network.Version)
-			}
-
-		}
-
-		numInitialStakers := len(network.GenesisConfig.InitialStakers)
-
-		if int(numValidators) < numInitialStakers {
-			return fmt.Errorf("network needs at least all initial stakers to be started: %d < %d", numValidators, numInitialStakers)
-		}
-
-		if int(numValidators) > len(network.Stakers) {
-			return fmt.Errorf("network config '%s' does not contain enough validators: %d > %d", networkName, numValidators, len(network.Stakers))
-		}
-
-		err = k8s.CreateNamespace(cmd.Context(), k, k8sConfig)
+		reporter, err := newReporter(cmd)
 		if err != nil {
 			return err
 		}
+		defer reporter.Close()
 
-		err = k8s.CopySecretFromDefaultNamespace(ctx, k, k8sConfig, pullSecretName)
-		if err != nil {
-			return err
-		}
-		err = k8s.CopySecretFromDefaultNamespace(ctx, k, k8sConfig, tlsSecretName)
-		if err != nil {
-			return err
-		}
-		err = k8s.CreateRBAC(ctx, k, k8sConfig)
+		lock, err := deployNetwork(ctx, kRest, k, reporter, deployment{
+			K8sConfig: k8sConfig,
+			Spec:      spec,
+			Operation: "create",
+			Force:     force,
+			TTL:       ttl,
+		})
 		if err != nil {
 			return err
 		}
+		defer lock.Release()
+		ctx = lock.Context()
 
-		now := time.Now().Unix()
-		genesisConfig := version1.BuildGenesisConfig(network.GenesisConfig.Allocations, uint64(now), network.Stakers[:numValidators], networkName)
-
-		// err = k8s.CreateNetworkConfigMap(ctx, k, network.GenesisConfig, k8sConfig)
-		err = k8s.CreateNetworkConfigMap(ctx, k, genesisConfig, k8sConfig)
-		if err != nil {
-			return err
-		}
-
-		err = k8s.CreateScriptsConfigMap(ctx, k, k8sConfig)
-		if err != nil {
-			return err
-		}
-
-		err = k8s.CreateStakerSecrets(ctx, k, network.Stakers, k8sConfig)
-		if err != nil {
-			return err
-		}
-
-		err = k8s.CreateRootNode(ctx, kRest, k, k8sConfig)
-		if err != nil {
-			return err
-		}
-
-		err = k8s.CreateValidators(ctx, kRest, k, k8sConfig, int32(numValidators)-1)
-		if err != nil {
-			return err
-		}
-
-		err = k8s.CreateApiNodes(ctx, kRest, k, k8sConfig, int32(numApiNodes))
-		if err != nil {
-			return err
-		}
+		phase := reporter.Start("registration")
+		if bootstrapJob {
+			registerArgs := []string{
+				"k8s", "register", networkName,
+				"--kubeconfig=",
+				"--connection", string(k8s.CONNECTION_SERVICE),
+				"--from", strconv.Itoa(numInitialStakers),
+				"--to", strconv.FormatUint(numValidators, 10),
+				// the job cannot read the namespace, this command already checked it and holds the lock
+				"--tls", k8sConfig.TLS.Mode,
+				"--skip-ownership-check",
+				"--no-lock",
+			}
+			for _, flag := range []string{"log-format", "log-level"} {
+				value, err := cmd.Flags().GetString(flag)
+				if err != nil {
+					return err
+				}
+				registerArgs = append(registerArgs, fmt.Sprintf("--%s=%s", flag, value))
+			}
 
-		ingAnnotations := map[string]string{
-			"cert-manager.io/cluster-issuer": "prod-letsencrypt",
+			err = k8s.CreateRBAC(ctx, kRest, k8sConfig)
+			if err == nil {
+				err = k8s.RunBootstrapJob(ctx, k, k8sConfig, bootstrapImage, registerArgs, reporter.LogOutput())
+			}
+		} else {
+			var conn *k8s.NodeConnection
+			conn, err = k8s.ConnectToNode(ctx, kRest, k8sConfig, connectionMode, "root")
+			if err == nil {
+				defer conn.Close()
+				err = k8s.RegisterValidators(ctx, conn, network.Stakers[numInitialStakers:numValidators], true, phase)
+			}
 		}
-
-		err = k8s.CreateIngress(ctx, k, k8sConfig, ingAnnotations)
-		if err != nil {
+		if phase.Done(err) != nil {
 			return err
 		}
 
-		err = k8s.RegisterValidators(ctx, kRest, k8sConfig, network.Stakers[numInitialStakers:numValidators], true)
-		if err != nil {
-			return err
-		}
+		reporter.Close()
+		printNetworkSummary(os.Stdout, reporter, k8sConfig, network.Stakers[:numValidators], int(numApiNodes))
 
 		return nil
 	},
 }
+
+func printNetworkSummary(w io.Writer, reporter *progress.Reporter, k8sConfig version1.K8sConfig, validators []version1.Staker, numApiNodes int) {
+	fmt.Fprintf(w, "\nnetwork %s is up\n\n", k8sConfig.K8sPrefix)
+	reporter.Summary(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "api\t%s/\n", k8s.PublicURL(k8sConfig))
+	fmt.Fprintf(tw, "static\t%s/static\n", k8s.PublicURL(k8sConfig))
+	fmt.Fprintln(tw)
+	for i, node := range k8s.NodeNames(int32(len(validators)), int32(numApiNodes)) {
+		nodeID := "-"
+		if i < len(validators) {
+			nodeID = validators[i].NodeID.String()
+		}
+		if k8sConfig.Exposure.NodeRoutes {
+			fmt.Fprintf(tw, "%s\t%s\t%s%s/\n", k8sConfig.PrefixWith(node), nodeID, k8s.PublicURL(k8sConfig), k8s.NodePath(node))
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", k8sConfig.PrefixWith(node), nodeID)
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,185 @@
+/*
+ * deploy.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/progress"
+	"chain4travel.com/camktncr/pkg/version1"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/ava-labs/avalanchego/genesis"
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// deployment describes how deployNetwork brings up a network, create and restore only differ
+// in where the genesis and the node data come from
+type deployment struct {
+	K8sConfig version1.K8sConfig
+	Spec      networkSpec
+	// Operation is recorded as part of the lock holder
+	Operation string
+	Force     bool
+	TTL       time.Duration
+	// Genesis is deployed instead of the one built from the network file if set
+	Genesis *genesis.UnparsedConfig
+	// SeedVolumes prepares the data volumes of the nodes before any of them is started
+	SeedVolumes func(ctx context.Context) error
+}
+
+// deployNetwork applies everything a network consists of, phase by phase, and returns the lock of the network.
+// The caller has to release the lock, on error it is already released.
+func deployNetwork(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, reporter *progress.Reporter, d deployment) (*k8s.Lock, error) {
+	d.K8sConfig.NumStakers = int32(len(d.Spec.Network.Stakers))
+	k8sConfig := d.K8sConfig
+	spec := d.Spec
+
+	err := checkBootstrapNodes(k8sConfig, spec)
+	if err != nil {
+		return nil, err
+	}
+	err = k8s.CheckGoverningServices(ctx, clientset, k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	phase := reporter.Start("namespace")
+	lock, err := lockNamespace(ctx, restClient, clientset, d)
+	if phase.Done(err) != nil {
+		if _, ok := err.(*k8s.OwnershipError); ok {
+			return nil, fmt.Errorf("%w (use --force to reuse it anyway)", err)
+		}
+		return nil, err
+	}
+
+	err = deployPhases(lock.Context(), restClient, clientset, reporter, d)
+	if err != nil {
+		lock.Release()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// lockNamespace makes sure the namespace exists, takes the lock in it and records ownership and expiry under the lock.
+// Foreign namespaces are refused before the lock is taken, the check is repeated under the lock.
+func lockNamespace(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, d deployment) (*k8s.Lock, error) {
+	k8sConfig := d.K8sConfig
+
+	ownership, err := networkOwnership(ctx, clientset, k8sConfig, d.Spec, d.Force)
+	if err != nil {
+		return nil, err
+	}
+	err = k8s.EnsureNamespace(ctx, clientset, k8sConfig, ownership)
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := acquireNetworkLock(ctx, clientset, k8sConfig, d.Operation)
+	if err != nil {
+		return nil, err
+	}
+	ctx = lock.Context()
+
+	ownership, err = networkOwnership(ctx, clientset, k8sConfig, d.Spec, d.Force)
+	if err == nil {
+		err = k8s.CreateNamespace(ctx, restClient, k8sConfig, ownership)
+	}
+	if err == nil && d.TTL > 0 {
+		err = k8s.SetExpiry(ctx, clientset, k8sConfig, time.Now().Add(d.TTL))
+	}
+	if err != nil {
+		lock.Release()
+		return nil, err
+	}
+	return lock, nil
+}
+
+func deployPhases(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, reporter *progress.Reporter, d deployment) error {
+	k8sConfig := d.K8sConfig
+	spec := d.Spec
+
+	phase := reporter.Start("secrets")
+	err := k8s.CopySecretFromDefaultNamespace(ctx, restClient, clientset, k8sConfig, k8sConfig.PullSecretName)
+	if err == nil && k8sConfig.TLS.Mode == k8s.TLS_SECRET {
+		err = k8s.CopySecretFromDefaultNamespace(ctx, restClient, clientset, k8sConfig, k8sConfig.TLSSecretName)
+	}
+	if err == nil && k8sConfig.TLS.Mode == k8s.TLS_SELF_SIGNED {
+		err = writeSelfSignedCA(ctx, restClient, clientset, k8sConfig)
+	}
+	if err == nil {
+		err = k8s.CreateStakerSecrets(ctx, restClient, spec.Network.Stakers, k8sConfig)
+	}
+	if phase.Done(err) != nil {
+		return err
+	}
+
+	var genesisConfig genesis.UnparsedConfig
+	if d.Genesis != nil {
+		genesisConfig = *d.Genesis
+	} else {
+		genesisConfig, err = desiredGenesisConfig(ctx, clientset, k8sConfig, spec)
+		if err != nil {
+			return err
+		}
+	}
+
+	phase = reporter.Start("configmaps")
+	err = k8s.CreateNetworkConfigMap(ctx, restClient, genesisConfig, k8sConfig)
+	if err == nil {
+		err = k8s.CreateScriptsConfigMap(ctx, restClient, k8sConfig)
+	}
+	if err == nil {
+		err = k8s.CreateNodeConfigMap(ctx, restClient, genesisConfig, k8sConfig)
+	}
+	if phase.Done(err) != nil {
+		return err
+	}
+
+	if d.SeedVolumes != nil {
+		err = reporter.Start("volumes").Done(d.SeedVolumes(ctx))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = reporter.Start("root").Done(k8s.CreateRootNode(ctx, restClient, clientset, k8sConfig))
+	if err != nil {
+		return err
+	}
+
+	err = reporter.Start("validators").Done(k8s.CreateValidators(ctx, restClient, clientset, k8sConfig, int32(spec.NumValidators)-1))
+	if err != nil {
+		return err
+	}
+
+	err = reporter.Start("api").Done(k8s.CreateApiNodes(ctx, restClient, clientset, k8sConfig, int32(spec.NumApiNodes)))
+	if err != nil {
+		return err
+	}
+
+	return reporter.Start("ingress").Done(k8s.CreateIngress(ctx, restClient, k8sConfig, int32(spec.NumValidators), int32(spec.NumApiNodes)))
+}
+
+// writeSelfSignedCA stores the ca of a self-signed network as <network-name>-ca.crt so clients can trust it
+func writeSelfSignedCA(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	caPEM, err := k8s.CreateSelfSignedCertificate(ctx, restClient, clientset, k8sConfig)
+	if err != nil {
+		return err
+	}
+	caFile := fmt.Sprintf("%s-ca.crt", k8sConfig.K8sPrefix)
+	err = os.WriteFile(caFile, caPEM, 0644)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("wrote the ca of the self-signed certificate", zap.String("file", caFile))
+	return nil
+}
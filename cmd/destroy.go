@@ -7,15 +7,29 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
 	"time"
 
 	"chain4travel.com/camktncr/pkg"
-	"chain4travel.com/camktncr/pkg/version1"
 	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"golang.org/x/term"
 
 	"github.com/spf13/cobra"
 )
 
+func init() {
+	destroyCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation")
+	destroyCmd.Flags().Bool("delete-namespace", false, "also delete the namespace with everything else in it")
+	destroyCmd.Flags().Bool("keep-disks", false, "keep the persistent volume claims of the nodes")
+	destroyCmd.Flags().Bool("skip-ownership-check", false, "destroy even if the namespace was not created by camktncr for this network (e.g. networks created by older versions)")
+	destroyCmd.Flags().DurationP("timeout", "t", 10*time.Minute, "how long to wait for the resources to terminate (0 means no timeout)")
+}
+
 var destroyCmd = &cobra.Command{
 	Use:   "destroy <network-name>",
 	Short: "destroy the cluster",
@@ -28,26 +42,111 @@ var destroyCmd = &cobra.Command{
 			return err
 		}
 
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+		deleteNamespace, err := cmd.Flags().GetBool("delete-namespace")
+		if err != nil {
+			return err
+		}
+		keepDisks, err := cmd.Flags().GetBool("keep-disks")
+		if err != nil {
+			return err
+		}
+		if deleteNamespace && keepDisks {
+			return fmt.Errorf("--keep-disks cannot be combined with --delete-namespace")
+		}
+		skipOwnershipCheck, err := cmd.Flags().GetBool("skip-ownership-check")
+		if err != nil {
+			return err
+		}
+
+		timeoutDur, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		if timeoutDur > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeoutDur)
+			defer cancel()
+		}
+
 		kRest, k, err := pkg.InitClientSet(kubeconfig)
 		if err != nil {
 			return err
 		}
 
-		k8sConfig := version1.K8sConfig{
-			K8sPrefix: networkName,
-			Namespace: networkName,
-			Labels: map[string]string{
-				"network": networkName,
-			},
+		k8sConfig := networkK8sConfig(networkName)
+
+		if !skipOwnershipCheck {
+			err = k8s.CheckOwnership(ctx, k, k8sConfig)
+			if err != nil {
+				return fmt.Errorf("%w (use --skip-ownership-check to destroy anyway)", err)
+			}
+		}
+
+		lock, err := acquireNetworkLock(ctx, k, k8sConfig, "destroy")
+		if err != nil {
+			return err
 		}
+		defer lock.Release()
+		lockCtx := lock.Context()
 
-		err = k8s.DeleteCluster(cmd.Context(), kRest, k, k8sConfig, false)
+		objects, err := k8s.ListNetworkObjects(lockCtx, kRest, k8sConfig, keepDisks)
 		if err != nil {
 			return err
 		}
 
-		time.Sleep(20 * time.Second)
+		fmt.Fprintf(os.Stdout, "the following resources of network %s will be deleted:\n", networkName)
+		for _, obj := range objects {
+			fmt.Fprintf(os.Stdout, "  %s\n", obj)
+		}
+		if deleteNamespace {
+			fmt.Fprintf(os.Stdout, "  namespace/%s (with everything else in it)\n", k8sConfig.Namespace)
+		}
+
+		if !yes {
+			confirmed, err := confirm(os.Stdin, os.Stdout, "continue?")
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				return fmt.Errorf("aborted")
+			}
+		}
 
-		return nil
+		if deleteNamespace {
+			err = k8s.DeleteNamespace(lockCtx, k, k8sConfig)
+			if err != nil {
+				return err
+			}
+			// the lease goes away with the namespace, once the deletion is issued nothing can be changed anyway
+			lock.Release()
+			return k8s.WaitForDeletion(ctx, kRest, k, k8sConfig, keepDisks, true)
+		}
+
+		err = k8s.DeleteCluster(lockCtx, kRest, k8sConfig, keepDisks)
+		if err != nil {
+			return err
+		}
+		return k8s.WaitForDeletion(lockCtx, kRest, k, k8sConfig, keepDisks, false)
 	},
 }
+
+// confirm asks a yes/no question, it fails instead of asking if in is not a terminal
+func confirm(in *os.File, out io.Writer, question string) (bool, error) {
+	if !term.IsTerminal(int(in.Fd())) {
+		return false, fmt.Errorf("cannot ask for confirmation without a terminal, use --yes")
+	}
+
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,134 @@
+/*
+ * diff.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addNetworkFlags(diffCmd)
+	diffCmd.Flags().Bool("exit-code", false, "exit with status 1 if the network differs from the desired state")
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <network-name>",
+	Short: "shows how the running network differs from what create would deploy",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		exitCode, err := cmd.Flags().GetBool("exit-code")
+		if err != nil {
+			return err
+		}
+
+		k8sConfig, err := k8sConfigFromFlags(cmd, networkName)
+		if err != nil {
+			return err
+		}
+
+		spec, err := loadNetworkSpec(cmd, networkName)
+		if err != nil {
+			return err
+		}
+		err = checkBootstrapNodes(k8sConfig, spec)
+		if err != nil {
+			return err
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+
+		genesisConfig, err := desiredGenesisConfig(ctx, k, k8sConfig, spec)
+		if err != nil {
+			return err
+		}
+
+		// a namespace owned by someone else is shown as drift instead of refused
+		ownership, err := networkOwnership(ctx, k, k8sConfig, spec, true)
+		if err != nil {
+			return err
+		}
+
+		objs, err := k8s.DesiredNetworkObjects(ctx, k, k8sConfig, ownership, genesisConfig, spec.Network.Stakers, int32(spec.NumValidators), int32(spec.NumApiNodes))
+		if err != nil {
+			return err
+		}
+
+		diffs, err := k8s.DiffObjects(ctx, kRest, objs)
+		if err != nil {
+			return err
+		}
+
+		drift := printDiffs(os.Stdout, diffs)
+		if drift && exitCode {
+			return fmt.Errorf("network %s differs from the desired state", networkName)
+		}
+		return nil
+	},
+}
+
+// printDiffs writes every object that differs and returns whether there was any drift
+func printDiffs(w io.Writer, diffs []k8s.ObjectDiff) bool {
+	drift := false
+	for _, diff := range diffs {
+		if diff.Missing {
+			fmt.Fprintf(w, "+ %s %s (missing)\n", diff.Kind, diff.Name)
+			drift = true
+			continue
+		}
+		// fields only set by someone else are left alone by apply, they are no drift
+		if !diff.HasDrift() {
+			continue
+		}
+		drift = true
+
+		fmt.Fprintf(w, "~ %s %s\n", diff.Kind, diff.Name)
+		for _, change := range diff.Changes {
+			fmt.Fprintf(w, "    %s: %s -> %s", change.Path, formatValue(change.Live), formatValue(change.Desired))
+			if len(change.Managers) > 0 {
+				fmt.Fprintf(w, " (changed by %s)", strings.Join(change.Managers, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if !drift {
+		fmt.Fprintln(w, "no differences")
+	}
+	return drift
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
@@ -0,0 +1,99 @@
+/*
+ * extend.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	extendCmd.Flags().Duration("by", 24*time.Hour, "how far to push out the expiry, counted from now if the network already expired")
+	extendCmd.Flags().Bool("never", false, "remove the expiry, the network is never garbage collected")
+}
+
+var extendCmd = &cobra.Command{
+	Use:   "extend <network-name>",
+	Short: "pushes out the expiry of a network created with --ttl",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		by, err := cmd.Flags().GetDuration("by")
+		if err != nil {
+			return err
+		}
+		if by <= 0 {
+			return fmt.Errorf("--by has to be positive")
+		}
+		never, err := cmd.Flags().GetBool("never")
+		if err != nil {
+			return err
+		}
+
+		_, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		k8sConfig := networkK8sConfig(networkName)
+
+		err = k8s.CheckOwnership(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		lock, err := acquireNetworkLock(ctx, k, k8sConfig, "extend")
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+		ctx = lock.Context()
+
+		if never {
+			err = k8s.ClearExpiry(ctx, k, k8sConfig)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stdout, "network %s never expires\n", networkName)
+			return nil
+		}
+
+		expiresAt, found, err := k8s.GetExpiry(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("network %s does not expire", networkName)
+		}
+
+		now := time.Now()
+		if expiresAt.Before(now) {
+			expiresAt = now
+		}
+		expiresAt = expiresAt.Add(by)
+
+		err = k8s.SetExpiry(ctx, k, k8sConfig, expiresAt)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "network %s expires at %s\n", networkName, expiresAt.Format(time.RFC3339))
+		return nil
+	},
+}
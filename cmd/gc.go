@@ -0,0 +1,143 @@
+/*
+ * gc.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/logging"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func init() {
+	gcCmd.Flags().Bool("dry-run", false, "only log which networks would be destroyed")
+	gcCmd.Flags().Bool("keep-namespace", false, "only delete the network resources and keep the (then empty) namespace")
+	gcCmd.Flags().DurationP("timeout", "t", 10*time.Minute, "how long to wait for the resources of each network to terminate (0 means no timeout)")
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "destroys all networks whose ttl expired (e.g. from a CronJob)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		keepNamespace, err := cmd.Flags().GetBool("keep-namespace")
+		if err != nil {
+			return err
+		}
+		timeoutDur, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		networks, err := k8s.ListNetworks(cmd.Context(), kRest, k)
+		if err != nil {
+			return err
+		}
+
+		expired := k8s.Expired(networks, time.Now())
+		if len(expired) == 0 {
+			zap.L().Info("no expired networks")
+			return nil
+		}
+
+		failed := 0
+		for _, network := range expired {
+			logger := zap.L().With(logging.Network(network.Name), zap.Time("expiredAt", *network.ExpiresAt))
+			if dryRun {
+				logger.Info("would destroy expired network")
+				continue
+			}
+
+			logger.Info("destroying expired network")
+			err := collectNetwork(cmd.Context(), kRest, k, network, keepNamespace, timeoutDur)
+			if err != nil {
+				// a network in use is collected by a later run
+				var lockErr *k8s.LockError
+				if errors.As(err, &lockErr) {
+					logger.Warn("skipping locked network", zap.Error(err))
+					continue
+				}
+				logger.Error("could not destroy expired network", zap.Error(err))
+				failed++
+				continue
+			}
+			logger.Info("destroyed expired network")
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("could not destroy %d of %d expired networks", failed, len(expired))
+		}
+		return nil
+	},
+}
+
+func collectNetwork(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, network k8s.NetworkInfo, keepNamespace bool, timeoutDur time.Duration) error {
+	if timeoutDur > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeoutDur)
+		defer cancel()
+	}
+
+	k8sConfig := networkK8sConfig(network.Name)
+	k8sConfig.Namespace = network.Namespace
+
+	// only create sets an expiry, but the namespace could have been taken over since
+	err := k8s.CheckOwnership(ctx, clientset, k8sConfig)
+	if err != nil {
+		return err
+	}
+
+	lock, err := acquireNetworkLock(ctx, clientset, k8sConfig, "gc")
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	err = k8s.DeleteCluster(lock.Context(), restClient, k8sConfig, false)
+	if err != nil {
+		return err
+	}
+	err = k8s.WaitForDeletion(lock.Context(), restClient, clientset, k8sConfig, false, false)
+	if err != nil {
+		return err
+	}
+
+	if keepNamespace {
+		// otherwise the empty namespace would be collected again by every run
+		return k8s.ClearExpiry(lock.Context(), clientset, k8sConfig)
+	}
+
+	err = k8s.DeleteNamespace(lock.Context(), clientset, k8sConfig)
+	if err != nil {
+		return err
+	}
+	lock.Release()
+	return k8s.WaitForDeletion(ctx, restClient, clientset, k8sConfig, false, true)
+}
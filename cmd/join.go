@@ -0,0 +1,140 @@
+/*
+ * join.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	exportJoinConfigCmd.Flags().StringP("output", "o", "", "directory the join config is written to (<network-name>-join if empty)")
+	exportJoinConfigCmd.Flags().Bool("generate-staker", false, "also generate the staking certificate of a new node")
+	exportJoinConfigCmd.Flags().DurationP("timeout", "t", time.Minute, "stop execution after this time (0 means no timeout)")
+}
+
+var exportJoinConfigCmd = &cobra.Command{
+	Use:   "export-join-config <network-name>",
+	Short: "writes what a node outside of the cluster needs to join a network",
+	Long: `writes the live genesis and join.json with the network id and the validators whose staking port is exposed
+(k8s create --expose-staking) as bootstrap nodes. With --generate-staker a new staking certificate is written as well,
+its node id can be registered as validator with k8s register --node-id.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+		dir, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			dir = fmt.Sprintf("%s-join", networkName)
+		}
+		generateStaker, err := cmd.Flags().GetBool("generate-staker")
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := contextWithTimeoutFlag(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		_, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+
+		err = k8s.CheckOwnership(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		genesisJson, err := k8s.LiveGenesis(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+		joinConfig, err := k8s.BuildJoinConfig(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+		joinJson, err := json.MarshalIndent(joinConfig, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dir, k8s.SNAPSHOT_GENESIS_FILE), genesisJson, 0644)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dir, k8s.JOIN_CONFIG_FILE), joinJson, 0644)
+		if err != nil {
+			return err
+		}
+
+		flags := joinConfig.Flags(k8s.SNAPSHOT_GENESIS_FILE)
+		registerHint := ""
+
+		if generateStaker {
+			nodeID, _, certBytes, keyBytes, err := version1.NewStakingCertificate()
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(filepath.Join(dir, k8s.STAKER_CERT_FILE), certBytes, 0644)
+			if err != nil {
+				return err
+			}
+			// the key is the identity of the node
+			err = os.WriteFile(filepath.Join(dir, k8s.STAKER_KEY_FILE), keyBytes, 0600)
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(filepath.Join(dir, k8s.NODE_ID_FILE), []byte(nodeID.String()), 0644)
+			if err != nil {
+				return err
+			}
+			flags = append(flags,
+				fmt.Sprintf("--staking-tls-cert-file=%s", k8s.STAKER_CERT_FILE),
+				fmt.Sprintf("--staking-tls-key-file=%s", k8s.STAKER_KEY_FILE),
+			)
+
+			numValidators, err := k8s.NumRunningValidators(ctx, k, k8sConfig)
+			if err != nil {
+				return err
+			}
+			// the stakers after the running ones are funded by the genesis but not used
+			registerHint = fmt.Sprintf("\nonce the node is bootstrapped, register it as validator with the funds of an unused staker:\n  camktncr k8s register %s --node-id %s --from %d --to %d\n",
+				networkName, nodeID, numValidators, numValidators+1)
+		}
+
+		fmt.Fprintf(os.Stdout, "join config of %s with %d bootstrap nodes written to %s, start the node in that directory with:\n  camino-node %s\n",
+			networkName, len(joinConfig.BootstrapIPs), dir, strings.Join(flags, " "))
+		fmt.Fprint(os.Stdout, registerHint)
+		return nil
+	},
+}
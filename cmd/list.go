@@ -0,0 +1,113 @@
+/*
+ * list.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+)
+
+func init() {
+	listCmd.Flags().StringP("output", "o", OUTPUT_TABLE, "output format: table or json")
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists all networks on the cluster",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if output != OUTPUT_TABLE && output != OUTPUT_JSON {
+			return fmt.Errorf("unknown output format '%s', expected %s or %s", output, OUTPUT_TABLE, OUTPUT_JSON)
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		networks, err := k8s.ListNetworks(cmd.Context(), kRest, k)
+		if err != nil {
+			return err
+		}
+
+		if output == OUTPUT_JSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(networks)
+		}
+
+		printNetworks(os.Stdout, networks, time.Now())
+		return nil
+	},
+}
+
+func printNetworks(w io.Writer, networks []k8s.NetworkInfo, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tNAMESPACE\tCREATOR\tVALIDATORS\tAPI\tAGE\tEXPIRES\tHOST\tHEALTH\tIMAGE")
+	for _, n := range networks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			n.Name, n.Namespace, orDash(n.Creator), n.Validators, n.ApiNodes, age(n.CreatedAt, now), expires(n.ExpiresAt, now), orDash(n.IngressHost), n.Health, orDash(n.Image))
+	}
+	tw.Flush()
+}
+
+// age formats like kubectl, e.g. 5m, 3h or 12d
+func age(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func expires(t *time.Time, now time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	if t.Before(now) {
+		return "expired"
+	}
+	// the remaining time is formatted like an age
+	return "in " + age(now, *t)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,713 @@
+/*
+ * network_flags.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/ava-labs/avalanchego/genesis"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+// networkSpec is the network file together with the node counts it is deployed with
+type networkSpec struct {
+	Network           *version1.Network
+	NumValidators     uint64
+	NumApiNodes       uint64
+	NumInitialStakers int
+	// sha256 of the network file, recorded on the namespace to recognize the network
+	NetworkHash string
+}
+
+// addNetworkFlags registers the flags describing how a network is deployed,
+// shared by all commands that need to know the desired state of a network
+func addNetworkFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint64("api-nodes", 2, "number of api-nodes")
+	cmd.Flags().Uint64("validators", 5, "number of validators to create (cannot be higher than the initial generated number)")
+	cmd.Flags().Int32("bootstrap-nodes", 1, "number of validators (root-0 and the first validators, at most the initial stakers) every node bootstraps from")
+	cmd.Flags().String("validator-ram", "1Gi", "ram of the validators")
+	cmd.Flags().String("validator-cpu", "500m", "cpu of the validators")
+	cmd.Flags().String("api-nodes-ram", "1Gi", "ram of the api-nodes")
+	cmd.Flags().String("api-nodes-cpu", "500m", "cpu of the api-nodes")
+	cmd.Flags().String("validator-ram-limit", "", "ram limit of the validators (no limit if empty)")
+	cmd.Flags().String("validator-cpu-limit", "", "cpu limit of the validators (no limit if empty)")
+	cmd.Flags().String("api-nodes-ram-limit", "", "ram limit of the api-nodes (no limit if empty)")
+	cmd.Flags().String("api-nodes-cpu-limit", "", "cpu limit of the api-nodes (no limit if empty)")
+	cmd.Flags().String("tls", k8s.TLS_CERT_MANAGER, "how the public endpoint gets its certificate: cert-manager, secret (--tls-secret-name), self-signed (ca written to <network-name>-ca.crt) or none (plain http)")
+	cmd.Flags().String("issuer", "prod-letsencrypt", "cert-manager issuer of the certificate (with --tls cert-manager)")
+	cmd.Flags().String("issuer-kind", "ClusterIssuer", "kind of the cert-manager issuer: ClusterIssuer or Issuer (an Issuer has to exist in the network namespace)")
+	cmd.Flags().String("tls-secret-name", "kopernikus.camino.foundation-ingress-tls", "tls secret located in default namespace, e.g. a wildcard certificate for the domain (with --tls secret)")
+	cmd.Flags().String("pull-secret-name", "gcr-image-pull", "pull secret located in default namespace")
+	cmd.Flags().String("image", "europe-west3-docker.pkg.dev/pwk-c4t-dev/internal-camino-dev/camino-node:tiedemann-64de0a0003bfab988da62850eef37ef01f82fdad-1668765791", "docker image to run the nodes")
+	cmd.Flags().Bool("enable-monitoring", true, "toggle the creation of service monitors")
+	cmd.Flags().BoolP("ignore-version-check", "c", false, "deploy a network file generated by another camktncr version")
+	cmd.Flags().Duration("root-startup-timeout", 15*time.Minute, "time the root node may take to bootstrap before it is restarted")
+	cmd.Flags().Duration("validator-startup-timeout", 30*time.Minute, "time a validator may take to bootstrap before it is restarted")
+	cmd.Flags().Duration("api-nodes-startup-timeout", time.Hour, "time an api-node may take to bootstrap before it is restarted")
+	cmd.Flags().StringSlice("disable-probes", []string{}, "roles (root, validator, api) whose nodes get no startup, readiness and liveness probes")
+	cmd.Flags().String("root-storage", "10Gi", "size of the data volume of the root node")
+	cmd.Flags().String("validator-storage", "10Gi", "size of the data volumes of the validators")
+	cmd.Flags().String("api-nodes-storage", "10Gi", "size of the data volumes of the api-nodes")
+	cmd.Flags().String("root-storage-class", "", "storage class of the data volume of the root node (cluster default if empty)")
+	cmd.Flags().String("validator-storage-class", "", "storage class of the data volumes of the validators (cluster default if empty)")
+	cmd.Flags().String("api-nodes-storage-class", "", "storage class of the data volumes of the api-nodes (cluster default if empty)")
+	cmd.Flags().StringToString("root-node-selector", map[string]string{}, "node labels the root node has to be scheduled on")
+	cmd.Flags().StringToString("validator-node-selector", map[string]string{}, "node labels the validators have to be scheduled on")
+	cmd.Flags().StringToString("api-nodes-node-selector", map[string]string{}, "node labels the api-nodes have to be scheduled on")
+	cmd.Flags().StringSlice("root-tolerations", []string{}, "taints the root node tolerates as key[=value][:effect]")
+	cmd.Flags().StringSlice("validator-tolerations", []string{}, "taints the validators tolerate as key[=value][:effect]")
+	cmd.Flags().StringSlice("api-nodes-tolerations", []string{}, "taints the api-nodes tolerate as key[=value][:effect]")
+	cmd.Flags().String("validator-anti-affinity", version1.ANTI_AFFINITY_NONE, "spread the root node and the validators over the topology key: none, preferred or required")
+	cmd.Flags().String("api-nodes-anti-affinity", version1.ANTI_AFFINITY_NONE, "spread the api-nodes over the topology key: none, preferred or required")
+	cmd.Flags().String("anti-affinity-topology-key", "kubernetes.io/hostname", "node label the anti-affinity spreads over, e.g. topology.kubernetes.io/zone")
+	cmd.Flags().String("ingress", k8s.INGRESS_NGINX, "how the network is published: nginx (Ingress), traefik (IngressRoute) or gateway (Gateway API HTTPRoute)")
+	cmd.Flags().String("ingress-class", "", "ingress class of the Ingress or IngressRoute (nginx if empty for the nginx ingress)")
+	cmd.Flags().StringSlice("traefik-entrypoints", []string{"websecure"}, "traefik entry points the IngressRoute listens on")
+	cmd.Flags().String("gateway", "", "[<namespace>/]<name> of the Gateway the HTTPRoute is attached to (required with --ingress gateway)")
+	cmd.Flags().String("gateway-section", "", "listener of the Gateway the HTTPRoute is attached to (all listeners if empty)")
+	cmd.Flags().Bool("node-routes", false, "publish every node under /nodes/<node>/ of the public url, e.g. /nodes/validator-0/ext/health")
+	cmd.Flags().String("expose-staking", k8s.EXPOSE_STAKING_NONE, "expose the staking port of every validator outside the cluster: none, loadbalancer or nodeport")
+	cmd.Flags().StringToString("staking-service-annotations", map[string]string{}, "annotations of the staking services, e.g. to request a static ip from the cloud provider")
+	cmd.Flags().StringToString("node-config", map[string]string{}, "camino-node flags of all nodes as key=value, e.g. log-level=info (values are parsed as json if possible)")
+	cmd.Flags().StringToString("root-node-config", map[string]string{}, "camino-node flags of the root node, they take precedence over --node-config")
+	cmd.Flags().StringToString("validator-node-config", map[string]string{}, "camino-node flags of the validators, they take precedence over --node-config")
+	cmd.Flags().StringToString("api-nodes-node-config", map[string]string{}, "camino-node flags of the api-nodes, they take precedence over --node-config")
+	cmd.Flags().String("c-chain-config", "", "config.json of the C-chain passed to every node (none if empty)")
+	cmd.Flags().StringSlice("ephemeral-storage", []string{}, "roles (root, validator, api) whose nodes keep their data in an emptyDir that is lost with the pod")
+}
+
+// networkK8sConfig is the part of the configuration that identifies the resources of a network
+func networkK8sConfig(networkName string) version1.K8sConfig {
+	return version1.K8sConfig{
+		K8sPrefix: networkName,
+		Namespace: networkName,
+		Labels: map[string]string{
+			k8s.NETWORK_LABEL: networkName,
+		},
+	}
+}
+
+func k8sConfigFromFlags(cmd *cobra.Command, networkName string) (version1.K8sConfig, error) {
+	k8sConfig := networkK8sConfig(networkName)
+
+	image, err := cmd.Flags().GetString("image")
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	domain, err := cmd.Flags().GetString("domain")
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	validatorRequests, err := requestsFromFlags(cmd, "validator")
+	if err != nil {
+		return k8sConfig, err
+	}
+	apiRequests, err := requestsFromFlags(cmd, "api-nodes")
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	tlsSecretName, err := cmd.Flags().GetString("tls-secret-name")
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	pullSecretName, err := cmd.Flags().GetString("pull-secret-name")
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	enableMonitoring, err := cmd.Flags().GetBool("enable-monitoring")
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	bootstrapNodes, err := cmd.Flags().GetInt32("bootstrap-nodes")
+	if err != nil {
+		return k8sConfig, err
+	}
+	if bootstrapNodes < 1 {
+		return k8sConfig, fmt.Errorf("--bootstrap-nodes has to be at least 1")
+	}
+
+	probes, err := probesFromFlags(cmd)
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	storage, err := storageFromFlags(cmd)
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	validatorLimits, err := limitsFromFlags(cmd, "validator")
+	if err != nil {
+		return k8sConfig, err
+	}
+	apiLimits, err := limitsFromFlags(cmd, "api-nodes")
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	scheduling, err := schedulingFromFlags(cmd)
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	ingress, err := ingressFromFlags(cmd)
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	tlsConfig, err := tlsFromFlags(cmd)
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	exposure, err := exposureFromFlags(cmd)
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	nodeConfig, err := nodeConfigFromFlags(cmd)
+	if err != nil {
+		return k8sConfig, err
+	}
+
+	k8sConfig.Image = image
+	k8sConfig.Domain = domain
+	k8sConfig.TLSSecretName = tlsSecretName
+	k8sConfig.PullSecretName = pullSecretName
+	k8sConfig.Resources = version1.K8sResources{
+		Api:             apiRequests,
+		Validator:       validatorRequests,
+		ApiLimits:       apiLimits,
+		ValidatorLimits: validatorLimits,
+		Storage:         storage,
+	}
+	k8sConfig.Probes = probes
+	k8sConfig.Scheduling = scheduling
+	k8sConfig.Ingress = ingress
+	k8sConfig.TLS = tlsConfig
+	k8sConfig.Exposure = exposure
+	k8sConfig.NodeConfig = nodeConfig
+	k8sConfig.EnableMonitoring = enableMonitoring
+	k8sConfig.BootstrapNodes = bootstrapNodes
+
+	return k8sConfig, nil
+}
+
+func probesFromFlags(cmd *cobra.Command) (version1.K8sProbes, error) {
+	probes := version1.K8sProbes{}
+
+	disabled, err := cmd.Flags().GetStringSlice("disable-probes")
+	if err != nil {
+		return probes, err
+	}
+
+	roles := map[string]*version1.K8sProbe{
+		"root":      &probes.Root,
+		"validator": &probes.Validator,
+		"api":       &probes.Api,
+	}
+	flags := map[string]string{
+		"root":      "root-startup-timeout",
+		"validator": "validator-startup-timeout",
+		"api":       "api-nodes-startup-timeout",
+	}
+
+	for role, probe := range roles {
+		probe.StartupTimeout, err = cmd.Flags().GetDuration(flags[role])
+		if err != nil {
+			return probes, err
+		}
+	}
+
+	for _, role := range disabled {
+		probe, ok := roles[role]
+		if !ok {
+			return probes, fmt.Errorf("unknown role '%s' in --disable-probes", role)
+		}
+		probe.Disabled = true
+	}
+
+	return probes, nil
+}
+
+func ingressFromFlags(cmd *cobra.Command) (version1.K8sIngress, error) {
+	ingress := version1.K8sIngress{}
+
+	provider, err := cmd.Flags().GetString("ingress")
+	if err != nil {
+		return ingress, err
+	}
+	ingress.Provider, err = k8s.ParseIngressProvider(provider)
+	if err != nil {
+		return ingress, err
+	}
+
+	ingress.ClassName, err = cmd.Flags().GetString("ingress-class")
+	if err != nil {
+		return ingress, err
+	}
+
+	ingress.EntryPoints, err = cmd.Flags().GetStringSlice("traefik-entrypoints")
+	if err != nil {
+		return ingress, err
+	}
+
+	gateway, err := cmd.Flags().GetString("gateway")
+	if err != nil {
+		return ingress, err
+	}
+	if provider == k8s.INGRESS_GATEWAY && gateway == "" {
+		return ingress, fmt.Errorf("--ingress %s requires a --gateway", k8s.INGRESS_GATEWAY)
+	}
+	if namespace, name, ok := strings.Cut(gateway, "/"); ok {
+		ingress.GatewayNamespace = namespace
+		ingress.GatewayName = name
+	} else {
+		ingress.GatewayName = gateway
+	}
+
+	ingress.GatewaySection, err = cmd.Flags().GetString("gateway-section")
+	if err != nil {
+		return ingress, err
+	}
+
+	return ingress, nil
+}
+
+func tlsFromFlags(cmd *cobra.Command) (version1.K8sTLS, error) {
+	tlsConfig := version1.K8sTLS{}
+
+	mode, err := cmd.Flags().GetString("tls")
+	if err != nil {
+		return tlsConfig, err
+	}
+	tlsConfig.Mode, err = k8s.ParseTLSMode(mode)
+	if err != nil {
+		return tlsConfig, err
+	}
+
+	tlsConfig.Issuer, err = cmd.Flags().GetString("issuer")
+	if err != nil {
+		return tlsConfig, err
+	}
+	issuerKind, err := cmd.Flags().GetString("issuer-kind")
+	if err != nil {
+		return tlsConfig, err
+	}
+	tlsConfig.IssuerKind, err = k8s.ParseIssuerKind(issuerKind)
+	if err != nil {
+		return tlsConfig, err
+	}
+
+	return tlsConfig, nil
+}
+
+func exposureFromFlags(cmd *cobra.Command) (version1.K8sExposure, error) {
+	exposure := version1.K8sExposure{}
+
+	var err error
+	exposure.NodeRoutes, err = cmd.Flags().GetBool("node-routes")
+	if err != nil {
+		return exposure, err
+	}
+
+	staking, err := cmd.Flags().GetString("expose-staking")
+	if err != nil {
+		return exposure, err
+	}
+	exposure.Staking, err = k8s.ParseStakingExposure(staking)
+	if err != nil {
+		return exposure, err
+	}
+
+	exposure.StakingAnnotations, err = cmd.Flags().GetStringToString("staking-service-annotations")
+	if err != nil {
+		return exposure, err
+	}
+
+	return exposure, nil
+}
+
+func nodeConfigFromFlags(cmd *cobra.Command) (version1.K8sNodeConfigs, error) {
+	nodeConfigs := version1.K8sNodeConfigs{}
+
+	common, err := cmd.Flags().GetStringToString("node-config")
+	if err != nil {
+		return nodeConfigs, err
+	}
+
+	roles := map[string]*map[string]interface{}{
+		"root":      &nodeConfigs.Root,
+		"validator": &nodeConfigs.Validator,
+		"api":       &nodeConfigs.Api,
+	}
+	flagPrefixes := map[string]string{
+		"root":      "root",
+		"validator": "validator",
+		"api":       "api-nodes",
+	}
+
+	for role, nodeConfig := range roles {
+		overrides, err := cmd.Flags().GetStringToString(flagPrefixes[role] + "-node-config")
+		if err != nil {
+			return nodeConfigs, err
+		}
+
+		*nodeConfig = map[string]interface{}{}
+		for _, flags := range []map[string]string{common, overrides} {
+			for k, v := range flags {
+				(*nodeConfig)[k] = parseNodeFlag(v)
+			}
+		}
+	}
+
+	cChainConfig, err := cmd.Flags().GetString("c-chain-config")
+	if err != nil {
+		return nodeConfigs, err
+	}
+	if cChainConfig != "" {
+		nodeConfigs.CChain, err = os.ReadFile(cChainConfig)
+		if err != nil {
+			return nodeConfigs, err
+		}
+		if !json.Valid(nodeConfigs.CChain) {
+			return nodeConfigs, fmt.Errorf("--c-chain-config %s is not valid json", cChainConfig)
+		}
+	}
+
+	return nodeConfigs, nil
+}
+
+// parseNodeFlag keeps numbers, booleans, lists and objects typed in the config.json, everything else is a string
+func parseNodeFlag(raw string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return raw
+	}
+	return value
+}
+
+// requestsFromFlags reads --<role>-cpu and --<role>-ram
+func requestsFromFlags(cmd *cobra.Command, role string) (v1.ResourceList, error) {
+	requests := v1.ResourceList{}
+	for resourceName, flag := range map[v1.ResourceName]string{
+		v1.ResourceCPU:    role + "-cpu",
+		v1.ResourceMemory: role + "-ram",
+	} {
+		value, err := cmd.Flags().GetString(flag)
+		if err != nil {
+			return nil, err
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s '%s': %w", flag, value, err)
+		}
+		requests[resourceName] = quantity
+	}
+	return requests, nil
+}
+
+// limitsFromFlags reads --<role>-cpu-limit and --<role>-ram-limit, the result is nil if neither is set
+func limitsFromFlags(cmd *cobra.Command, role string) (v1.ResourceList, error) {
+	var limits v1.ResourceList
+	for resourceName, flag := range map[v1.ResourceName]string{
+		v1.ResourceCPU:    role + "-cpu-limit",
+		v1.ResourceMemory: role + "-ram-limit",
+	} {
+		value, err := cmd.Flags().GetString(flag)
+		if err != nil {
+			return nil, err
+		}
+		if value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s '%s': %w", flag, value, err)
+		}
+		if limits == nil {
+			limits = v1.ResourceList{}
+		}
+		limits[resourceName] = quantity
+	}
+	return limits, nil
+}
+
+func schedulingFromFlags(cmd *cobra.Command) (version1.K8sSchedulings, error) {
+	schedulings := version1.K8sSchedulings{}
+
+	topologyKey, err := cmd.Flags().GetString("anti-affinity-topology-key")
+	if err != nil {
+		return schedulings, err
+	}
+
+	roles := map[string]*version1.K8sScheduling{
+		"root":      &schedulings.Root,
+		"validator": &schedulings.Validator,
+		"api":       &schedulings.Api,
+	}
+	flagPrefixes := map[string]string{
+		"root":      "root",
+		"validator": "validator",
+		"api":       "api-nodes",
+	}
+	// the root node is spread together with the validators
+	antiAffinityFlags := map[string]string{
+		"root":      "validator-anti-affinity",
+		"validator": "validator-anti-affinity",
+		"api":       "api-nodes-anti-affinity",
+	}
+
+	for role, scheduling := range roles {
+		prefix := flagPrefixes[role]
+
+		scheduling.NodeSelector, err = cmd.Flags().GetStringToString(prefix + "-node-selector")
+		if err != nil {
+			return schedulings, err
+		}
+
+		tolerations, err := cmd.Flags().GetStringSlice(prefix + "-tolerations")
+		if err != nil {
+			return schedulings, err
+		}
+		for _, raw := range tolerations {
+			toleration, err := parseToleration(raw)
+			if err != nil {
+				return schedulings, fmt.Errorf("invalid --%s-tolerations: %w", prefix, err)
+			}
+			scheduling.Tolerations = append(scheduling.Tolerations, toleration)
+		}
+
+		antiAffinity, err := cmd.Flags().GetString(antiAffinityFlags[role])
+		if err != nil {
+			return schedulings, err
+		}
+		scheduling.AntiAffinity, err = k8s.ParseAntiAffinity(antiAffinity)
+		if err != nil {
+			return schedulings, fmt.Errorf("invalid --%s: %w", antiAffinityFlags[role], err)
+		}
+		scheduling.TopologyKey = topologyKey
+	}
+
+	return schedulings, nil
+}
+
+// parseToleration parses key[=value][:effect] the way kubectl taint prints taints,
+// without a value any value of the key is tolerated and without an effect all effects are
+func parseToleration(raw string) (v1.Toleration, error) {
+	toleration := v1.Toleration{Operator: v1.TolerationOpExists}
+
+	keyValue, effect, hasEffect := strings.Cut(raw, ":")
+	if hasEffect {
+		switch v1.TaintEffect(effect) {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+			toleration.Effect = v1.TaintEffect(effect)
+		default:
+			return toleration, fmt.Errorf("unknown taint effect '%s' in '%s'", effect, raw)
+		}
+	}
+
+	key, value, hasValue := strings.Cut(keyValue, "=")
+	if key == "" {
+		return toleration, fmt.Errorf("missing key in '%s'", raw)
+	}
+	toleration.Key = key
+	if hasValue {
+		toleration.Operator = v1.TolerationOpEqual
+		toleration.Value = value
+	}
+	return toleration, nil
+}
+
+func storageFromFlags(cmd *cobra.Command) (version1.K8sStorages, error) {
+	storages := version1.K8sStorages{}
+
+	ephemeral, err := cmd.Flags().GetStringSlice("ephemeral-storage")
+	if err != nil {
+		return storages, err
+	}
+
+	roles := map[string]*version1.K8sStorage{
+		"root":      &storages.Root,
+		"validator": &storages.Validator,
+		"api":       &storages.Api,
+	}
+	flags := map[string]string{
+		"root":      "root-storage",
+		"validator": "validator-storage",
+		"api":       "api-nodes-storage",
+	}
+
+	for role, storage := range roles {
+		size, err := cmd.Flags().GetString(flags[role])
+		if err != nil {
+			return storages, err
+		}
+		storage.Size, err = resource.ParseQuantity(size)
+		if err != nil {
+			return storages, fmt.Errorf("invalid --%s '%s': %w", flags[role], size, err)
+		}
+
+		storage.StorageClass, err = cmd.Flags().GetString(flags[role] + "-class")
+		if err != nil {
+			return storages, err
+		}
+	}
+
+	for _, role := range ephemeral {
+		storage, ok := roles[role]
+		if !ok {
+			return storages, fmt.Errorf("unknown role '%s' in --ephemeral-storage", role)
+		}
+		storage.Ephemeral = true
+	}
+
+	return storages, nil
+}
+
+// checkBootstrapNodes makes sure only running initial stakers are bootstrap nodes, the others are not validators
+// before they are registered
+func checkBootstrapNodes(k8sConfig version1.K8sConfig, spec networkSpec) error {
+	if int(k8sConfig.BootstrapNodes) > spec.NumInitialStakers {
+		return fmt.Errorf("--bootstrap-nodes cannot be more than the %d initial stakers", spec.NumInitialStakers)
+	}
+	if uint64(k8sConfig.BootstrapNodes) > spec.NumValidators {
+		return fmt.Errorf("--bootstrap-nodes cannot be more than the %d validators", spec.NumValidators)
+	}
+	return nil
+}
+
+// loadNetworkSpec loads <network-name>.json and checks it can be deployed with the node counts of the flags
+func loadNetworkSpec(cmd *cobra.Command, networkName string) (networkSpec, error) {
+	spec := networkSpec{}
+
+	numValidators, err := cmd.Flags().GetUint64("validators")
+	if err != nil {
+		return spec, err
+	}
+
+	numApiNodes, err := cmd.Flags().GetUint64("api-nodes")
+	if err != nil {
+		return spec, err
+	}
+
+	ignoreVersion, err := cmd.Flags().GetBool("ignore-version-check")
+	if err != nil {
+		return spec, err
+	}
+
+	return networkSpecFromFile(fmt.Sprintf("%s.json", networkName), numValidators, numApiNodes, ignoreVersion)
+}
+
+// networkSpecFromFile loads a network file and checks it can be deployed with the given node counts
+func networkSpecFromFile(networkFile string, numValidators uint64, numApiNodes uint64, ignoreVersion bool) (networkSpec, error) {
+	spec := networkSpec{}
+
+	network, err := version1.LoadNetwork(networkFile)
+	if err != nil {
+		return spec, err
+	}
+
+	raw, err := os.ReadFile(networkFile)
+	if err != nil {
+		return spec, err
+	}
+	hash := sha256.Sum256(raw)
+
+	if !ignoreVersion {
+
+		if network.Version == "" {
+			return spec, fmt.Errorf("using old network json, please regenerate")
+		}
+
+		if network.Version != pkg.Commit() {
+			return spec, fmt.Errorf("cannot create network with different version, please checkout this commit and use that version to create the network: %s", network.Version)
+		}
+
+	}
+
+	numInitialStakers := len(network.GenesisConfig.InitialStakers)
+
+	if int(numValidators) < numInitialStakers {
+		return spec, fmt.Errorf("network needs at least all initial stakers to be started: %d < %d", numValidators, numInitialStakers)
+	}
+
+	if int(numValidators) > len(network.Stakers) {
+		return spec, fmt.Errorf("network config '%s' does not contain enough validators: %d > %d", networkFile, numValidators, len(network.Stakers))
+	}
+
+	return networkSpec{
+		Network:           network,
+		NumValidators:     numValidators,
+		NumApiNodes:       numApiNodes,
+		NumInitialStakers: numInitialStakers,
+		NetworkHash:       hex.EncodeToString(hash[:]),
+	}, nil
+}
+
+// desiredGenesisConfig builds the genesis of the network, a network that is already running keeps its start time
+func desiredGenesisConfig(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, spec networkSpec) (genesis.UnparsedConfig, error) {
+	startTime, found, err := k8s.LiveGenesisStartTime(ctx, clientset, k8sConfig)
+	if err != nil {
+		return genesis.UnparsedConfig{}, err
+	}
+	if !found {
+		startTime = uint64(time.Now().Unix())
+	}
+
+	network := spec.Network
+	return version1.BuildGenesisConfig(network.GenesisConfig.Allocations, startTime, network.Stakers[:spec.NumValidators], k8sConfig.K8sPrefix), nil
+}
+
+// networkOwnership is the ownership recorded on the namespace, see k8s.ResolveOwnership for force
+func networkOwnership(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, spec networkSpec, force bool) (k8s.Ownership, error) {
+	return k8s.ResolveOwnership(ctx, clientset, k8sConfig, k8s.Ownership{
+		Creator:     creator(),
+		Version:     pkg.Commit(),
+		NetworkHash: spec.NetworkHash,
+		CreatedAt:   time.Now(),
+	}, force)
+}
+
+// creator identifies who runs the command as <user>@<host>
+func creator() string {
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return username
+	}
+	return fmt.Sprintf("%s@%s", username, hostname)
+}
+
+// acquireNetworkLock takes the lock of the network for a mutating operation, release it with Release
+func acquireNetworkLock(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, operation string) (*k8s.Lock, error) {
+	holder := fmt.Sprintf("%s (%s, pid %d)", creator(), operation, os.Getpid())
+	return k8s.AcquireLock(ctx, clientset, k8sConfig, holder)
+}
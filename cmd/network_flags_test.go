@@ -0,0 +1,73 @@
+/*
+ * network_flags_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseToleration(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    v1.Toleration
+		wantErr bool
+	}{
+		{"dedicated", v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpExists}, false},
+		{"dedicated=camino", v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "camino"}, false},
+		{"dedicated=", v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual}, false},
+		{"dedicated:NoSchedule", v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpExists, Effect: v1.TaintEffectNoSchedule}, false},
+		{"dedicated=camino:NoExecute", v1.Toleration{Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "camino", Effect: v1.TaintEffectNoExecute}, false},
+		{"node.kubernetes.io/spot=true:PreferNoSchedule", v1.Toleration{Key: "node.kubernetes.io/spot", Operator: v1.TolerationOpEqual, Value: "true", Effect: v1.TaintEffectPreferNoSchedule}, false},
+		{"dedicated=camino:Sometimes", v1.Toleration{}, true},
+		{"dedicated:", v1.Toleration{}, true},
+		{"", v1.Toleration{}, true},
+		{"=camino", v1.Toleration{}, true},
+		{":NoSchedule", v1.Toleration{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parseToleration(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseNodeFlag(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want interface{}
+	}{
+		{"info", "info"},
+		{"9651", float64(9651)},
+		{"true", true},
+		{"\"quoted\"", "quoted"},
+		{"[\"a\",\"b\"]", []interface{}{"a", "b"}},
+		{"{\"enabled\":false}", map[string]interface{}{"enabled": false}},
+		{"null", nil},
+		{"", ""},
+		{"0.0.0.0", "0.0.0.0"},
+		{"{broken", "{broken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got := parseNodeFlag(tt.raw)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * pause.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	pauseCmd.Flags().DurationP("timeout", "t", 10*time.Minute, "stop execution after this time (0 means no timeout)")
+	resumeCmd.Flags().DurationP("timeout", "t", time.Hour, "stop execution after this time (0 means no timeout)")
+}
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause <network-name>",
+	Short: "scales all nodes of the network to zero, the chain data is kept",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := contextWithTimeoutFlag(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		_, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+
+		err = k8s.CheckOwnership(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		lock, err := acquireNetworkLock(ctx, k, k8sConfig, "pause")
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
+		return k8s.PauseNetwork(lock.Context(), k, k8sConfig)
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume <network-name>",
+	Short: "restores the nodes of a paused network, root first, and waits until it is healthy",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		domain, err := cmd.Flags().GetString("domain")
+		if err != nil {
+			return err
+		}
+
+		connection, err := cmd.Flags().GetString("connection")
+		if err != nil {
+			return err
+		}
+		connectionMode, err := k8s.ParseConnectionMode(connection)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := contextWithTimeoutFlag(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+		k8sConfig.Domain = domain
+
+		err = k8s.CheckOwnership(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+		k8sConfig.TLS.Mode, err = k8s.LoadTLSMode(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		lock, err := acquireNetworkLock(ctx, k, k8sConfig, "resume")
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+		ctx = lock.Context()
+
+		resumedAt := time.Now()
+		err = k8s.ResumeNetwork(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		status, err := k8s.VerifyResumed(ctx, kRest, k, k8sConfig, connectionMode, resumedAt)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "network %s resumed, %d validators are bootstrapped and healthy\n", networkName, len(status.Nodes))
+		if status.PChainAdvanced {
+			fmt.Fprintf(os.Stdout, "the p-chain accepted blocks since the resume (p-chain time %s)\n", status.PChainTime.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(os.Stdout, "block production is not verified: the p-chain time %s has not moved past the resume within %s\n",
+				status.PChainTime.Format(time.RFC3339), k8s.PCHAIN_ADVANCE_TIMEOUT)
+		}
+		return nil
+	},
+}
+
+// contextWithTimeoutFlag returns the command context limited by the --timeout flag
+func contextWithTimeoutFlag(cmd *cobra.Command) (context.Context, context.CancelFunc, error) {
+	timeoutDur, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeoutDur > 0 {
+		ctx, cancel := context.WithTimeout(cmd.Context(), timeoutDur)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithCancel(cmd.Context())
+	return ctx, cancel, nil
+}
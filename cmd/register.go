@@ -0,0 +1,162 @@
+/*
+ * register.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/ava-labs/avalanchego/ids"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	registerCmd.Flags().Int("from", 0, "index of the first staker to register as validator")
+	registerCmd.Flags().Int("to", 0, "index after the last staker to register as validator")
+	registerCmd.Flags().String("node-id", "", "register this node id (e.g. of a node outside of the cluster) instead, the single staker given by --from and --to pays the stake")
+	registerCmd.Flags().String("tls", "", "tls mode the network was created with, read from the network namespace if empty")
+	registerCmd.Flags().Bool("skip-ownership-check", false, "register even if the namespace was not created by camktncr for this network (e.g. networks created by older versions)")
+	registerCmd.Flags().Bool("no-lock", false, "do not take the network lock, only for a register started by a command holding it (the bootstrap job of create)")
+	registerCmd.Flags().DurationP("timeout", "t", 0, "stop execution after this time (non negative and 0 means no timeout)")
+}
+
+var registerCmd = &cobra.Command{
+	Use:   "register <network-name>",
+	Short: "registers the stakers stored in the network secrets as validators",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		domain, err := cmd.Flags().GetString("domain")
+		if err != nil {
+			return err
+		}
+
+		connection, err := cmd.Flags().GetString("connection")
+		if err != nil {
+			return err
+		}
+		connectionMode, err := k8s.ParseConnectionMode(connection)
+		if err != nil {
+			return err
+		}
+
+		from, err := cmd.Flags().GetInt("from")
+		if err != nil {
+			return err
+		}
+		to, err := cmd.Flags().GetInt("to")
+		if err != nil {
+			return err
+		}
+		if from < 0 || to < from {
+			return fmt.Errorf("invalid staker range [%d, %d)", from, to)
+		}
+
+		nodeIDFlag, err := cmd.Flags().GetString("node-id")
+		if err != nil {
+			return err
+		}
+		var externalNodeID *ids.NodeID
+		if nodeIDFlag != "" {
+			if to-from != 1 {
+				return fmt.Errorf("--node-id needs exactly one staker, got [%d, %d)", from, to)
+			}
+			nodeID, err := ids.NodeIDFromString(nodeIDFlag)
+			if err != nil {
+				return fmt.Errorf("invalid --node-id: %w", err)
+			}
+			externalNodeID = &nodeID
+		}
+
+		tlsMode, err := cmd.Flags().GetString("tls")
+		if err != nil {
+			return err
+		}
+		if tlsMode != "" {
+			tlsMode, err = k8s.ParseTLSMode(tlsMode)
+			if err != nil {
+				return err
+			}
+		}
+
+		skipOwnershipCheck, err := cmd.Flags().GetBool("skip-ownership-check")
+		if err != nil {
+			return err
+		}
+		noLock, err := cmd.Flags().GetBool("no-lock")
+		if err != nil {
+			return err
+		}
+
+		timeoutDur, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		if timeoutDur > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeoutDur)
+			defer cancel()
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+		k8sConfig.Domain = domain
+		if !skipOwnershipCheck {
+			err = k8s.CheckOwnership(ctx, k, k8sConfig)
+			if err != nil {
+				return fmt.Errorf("%w (use --skip-ownership-check to register anyway)", err)
+			}
+		}
+
+		k8sConfig.TLS.Mode = tlsMode
+		if tlsMode == "" {
+			k8sConfig.TLS.Mode, err = k8s.LoadTLSMode(ctx, k, k8sConfig)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !noLock {
+			lock, err := acquireNetworkLock(ctx, k, k8sConfig, "register")
+			if err != nil {
+				return err
+			}
+			defer lock.Release()
+			ctx = lock.Context()
+		}
+
+		stakers, err := k8s.LoadStakers(ctx, k, k8sConfig, from, to)
+		if err != nil {
+			return err
+		}
+		if externalNodeID != nil {
+			stakers[0].NodeID = *externalNodeID
+		}
+
+		conn, err := k8s.ConnectToNode(ctx, kRest, k8sConfig, connectionMode, "root")
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		return k8s.RegisterValidators(ctx, conn, stakers, true, nil)
+	},
+}
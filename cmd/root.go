@@ -9,31 +9,91 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
+	"chain4travel.com/camktncr/pkg/logging"
+	"chain4travel.com/camktncr/pkg/progress"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/term"
 	"k8s.io/client-go/util/homedir"
 )
 
-var rootCmd = &cobra.Command{Use: "camktncr", SilenceUsage: true}
+var rootCmd = &cobra.Command{
+	Use:          "camktncr",
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logFormat, err := cmd.Flags().GetString("log-format")
+		if err != nil {
+			return err
+		}
+		logLevel, err := cmd.Flags().GetString("log-level")
+		if err != nil {
+			return err
+		}
+
+		logger, err := logging.New(logFormat, logLevel)
+		if err != nil {
+			return err
+		}
+
+		// every command working on a network takes its name as first argument
+		if strings.Contains(cmd.Use, "<network-name>") && len(args) > 0 {
+			logger = logger.With(logging.Network(args[0]))
+		}
+
+		zap.ReplaceGlobals(logger)
+		return nil
+	},
+}
 var k8sCmd = &cobra.Command{Use: "k8s"}
 
 func init() {
 
-	k8sCmd.AddCommand(createCmd, destroyCmd)
+	k8sCmd.AddCommand(createCmd, destroyCmd, registerCmd, diffCmd, listCmd, gcCmd, extendCmd, pauseCmd, resumeCmd, snapshotCmd, restoreCmd, exportJoinConfigCmd)
 
 	if home := homedir.HomeDir(); home != "" {
 		k8sCmd.PersistentFlags().String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
 	} else {
 		k8sCmd.PersistentFlags().String("kubeconfig", "", "absolute path to the kubeconfig file")
 	}
+	k8sCmd.PersistentFlags().String("domain", "camino.network", "under which domain to publish the network api nodes")
+	k8sCmd.PersistentFlags().Bool("non-interactive", false, "log the progress instead of showing a live display (automatically the case if stderr is no terminal)")
+	k8sCmd.PersistentFlags().String("connection", string(k8s.CONNECTION_PORT_FORWARD), "how to reach the node apis: port-forward, ingress (https://<network-name>.<domain>) or service (only from inside the cluster)")
+
+	rootCmd.PersistentFlags().String("log-format", logging.FORMAT_TEXT, "format of the log output: text or json")
+	rootCmd.PersistentFlags().String("log-level", "info", "minimum level of the log output: debug, info, warn or error")
 
 	rootCmd.AddCommand(k8sCmd)
 	rootCmd.AddCommand(generateCmd)
 
 }
 
+// newReporter shows the progress live if possible and routes the log output through it
+func newReporter(cmd *cobra.Command) (*progress.Reporter, error) {
+	nonInteractive, err := cmd.Flags().GetBool("non-interactive")
+	if err != nil {
+		return nil, err
+	}
+	logFormat, err := cmd.Flags().GetString("log-format")
+	if err != nil {
+		return nil, err
+	}
+
+	interactive := !nonInteractive && logFormat == logging.FORMAT_TEXT && term.IsTerminal(int(os.Stderr.Fd()))
+	reporter := progress.New(os.Stderr, interactive)
+	if interactive {
+		logging.SetOutput(reporter)
+	}
+	return reporter, nil
+}
+
 func Run() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	// syncing stderr fails on some terminals, nothing to do about it
+	_ = zap.L().Sync()
+	if err != nil {
 		os.Exit(1)
 	}
 }
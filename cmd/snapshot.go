@@ -0,0 +1,287 @@
+/*
+ * snapshot.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func init() {
+	snapshotCmd.Flags().String("method", k8s.SNAPSHOT_METHOD_VOLUME, "how to capture the node data: volumesnapshot (csi snapshots, stay on the cluster) or tar (streamed out of the running pods)")
+	snapshotCmd.Flags().String("snapshot-class", "", "volume snapshot class to use (default class of the cluster if empty)")
+	snapshotCmd.Flags().String("name", "", "name of the snapshot (<network-name>-<timestamp> if empty)")
+	snapshotCmd.Flags().StringP("output", "o", "", "directory the snapshot is written to (the name of the snapshot if empty)")
+	snapshotCmd.Flags().Bool("pause", false, "pause the network while the volumes are snapshotted so the databases are consistent (volumesnapshot only)")
+	snapshotCmd.Flags().DurationP("timeout", "t", time.Hour, "stop execution after this time (0 means no timeout)")
+
+	addNetworkFlags(restoreCmd)
+	restoreCmd.Flags().DurationP("timeout", "t", 0, "stop execution after this time (non negative and 0 means no timeout)")
+	restoreCmd.Flags().Duration("ttl", 0, "garbage collect the network after this time, see k8s gc (0 means never)")
+	restoreCmd.Flags().Bool("force", false, "reuse the namespace even if it was not created for this network file")
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot <network-name>",
+	Short: "captures the node databases and the network files of a network so it can be restored",
+	Long: `captures the data volume of every node together with <network-name>.json and the live genesis.
+The snapshot directory can be passed to k8s restore to start a new network from it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		method, err := cmd.Flags().GetString("method")
+		if err != nil {
+			return err
+		}
+		method, err = k8s.ParseSnapshotMethod(method)
+		if err != nil {
+			return err
+		}
+		snapshotClass, err := cmd.Flags().GetString("snapshot-class")
+		if err != nil {
+			return err
+		}
+		pause, err := cmd.Flags().GetBool("pause")
+		if err != nil {
+			return err
+		}
+		if pause && method != k8s.SNAPSHOT_METHOD_VOLUME {
+			return fmt.Errorf("--pause only works with --method %s, tar needs the nodes running", k8s.SNAPSHOT_METHOD_VOLUME)
+		}
+
+		now := time.Now().UTC()
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = fmt.Sprintf("%s-%s", networkName, now.Format("20060102150405"))
+		}
+		dir, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			dir = name
+		}
+
+		networkFile, err := os.ReadFile(fmt.Sprintf("%s.json", networkName))
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel, err := contextWithTimeoutFlag(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+
+		err = k8s.CheckOwnership(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		lock, err := acquireNetworkLock(ctx, k, k8sConfig, "snapshot")
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+		ctx = lock.Context()
+
+		genesisJson, err := k8s.LiveGenesis(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dir, k8s.SNAPSHOT_NETWORK_FILE), networkFile, 0644)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dir, k8s.SNAPSHOT_GENESIS_FILE), genesisJson, 0644)
+		if err != nil {
+			return err
+		}
+
+		if pause {
+			wasPaused, err := k8s.IsPaused(ctx, k, k8sConfig)
+			if err != nil {
+				return err
+			}
+			if !wasPaused {
+				err = k8s.PauseNetwork(ctx, k, k8sConfig)
+				if err != nil {
+					return err
+				}
+				defer func() {
+					// the snapshot is usable even if the network does not come back
+					err := k8s.ResumeNetwork(ctx, k, k8sConfig)
+					if err != nil {
+						zap.L().Error("could not resume the network after the snapshot", zap.Error(err))
+					}
+				}()
+			}
+		}
+
+		manifest := &k8s.SnapshotManifest{
+			Name:      name,
+			Network:   networkName,
+			Method:    method,
+			CreatedAt: now,
+			Version:   pkg.Commit(),
+		}
+		err = k8s.SnapshotNetwork(ctx, kRest, k, k8sConfig, manifest, snapshotClass, dir)
+		if err != nil {
+			return err
+		}
+
+		err = k8s.WriteSnapshotManifest(dir, manifest)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "snapshot %s of %d nodes written to %s\n", name, len(manifest.Volumes), dir)
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <network-name> <snapshot-dir>",
+	Short: "creates a new network whose nodes start from the data of a snapshot",
+	Long: `creates a new network from a directory written by k8s snapshot.
+The network file, genesis, node counts and (unless --image is given) the image are taken from the snapshot,
+the validators are not registered again as they are part of the restored chain.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		networkName := args[0]
+		dir := args[1]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		ttl, err := cmd.Flags().GetDuration("ttl")
+		if err != nil {
+			return err
+		}
+
+		ignoreVersion, err := cmd.Flags().GetBool("ignore-version-check")
+		if err != nil {
+			return err
+		}
+
+		manifest, err := k8s.LoadSnapshotManifest(dir)
+		if err != nil {
+			return err
+		}
+
+		spec, err := networkSpecFromFile(filepath.Join(dir, k8s.SNAPSHOT_NETWORK_FILE), uint64(manifest.NumValidators), uint64(manifest.NumApiNodes), ignoreVersion)
+		if err != nil {
+			return err
+		}
+
+		rawGenesis, err := os.ReadFile(filepath.Join(dir, k8s.SNAPSHOT_GENESIS_FILE))
+		if err != nil {
+			return err
+		}
+		genesisConfig, err := k8s.ParseGenesis(rawGenesis)
+		if err != nil {
+			return fmt.Errorf("invalid genesis in snapshot %s: %w", dir, err)
+		}
+
+		k8sConfig, err := k8sConfigFromFlags(cmd, networkName)
+		if err != nil {
+			return err
+		}
+		// the databases may not be readable by other node versions
+		if !cmd.Flags().Changed("image") && manifest.Image != "" {
+			k8sConfig.Image = manifest.Image
+		}
+
+		timeoutDur, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context()
+		if timeoutDur > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeoutDur)
+			defer cancel()
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		_, exists, err := k8s.LiveGenesisStartTime(ctx, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("network %s already exists, restore only creates new networks", networkName)
+		}
+
+		reporter, err := newReporter(cmd)
+		if err != nil {
+			return err
+		}
+		defer reporter.Close()
+
+		lock, err := deployNetwork(ctx, kRest, k, reporter, deployment{
+			K8sConfig: k8sConfig,
+			Spec:      spec,
+			Operation: "restore",
+			Force:     force,
+			TTL:       ttl,
+			Genesis:   &genesisConfig,
+			SeedVolumes: func(ctx context.Context) error {
+				return k8s.SeedVolumes(ctx, kRest, k, k8sConfig, manifest, dir)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+
+		reporter.Close()
+		printNetworkSummary(os.Stdout, reporter, k8sConfig, spec.Network.Stakers[:spec.NumValidators], int(spec.NumApiNodes))
+
+		return nil
+	},
+}
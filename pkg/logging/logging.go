@@ -0,0 +1,87 @@
+/*
+ * logging.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+// keys of the fields attached to log lines, keep them stable so CI can parse them
+const (
+	NETWORK_KEY = "network"
+	NODE_ID_KEY = "nodeID"
+	PHASE_KEY   = "phase"
+)
+
+// output is shared by all loggers so it can be swapped, e.g. to keep a progress display intact
+var output = &switchableWriter{w: os.Stderr}
+
+type switchableWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchableWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// SetOutput redirects the output of all loggers, it defaults to stderr
+func SetOutput(w io.Writer) {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+	output.w = w
+}
+
+// New builds a logger writing to the shared output in the given format ("text" or "json") filtering below level
+func New(format string, level string) (*zap.Logger, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	var encoder zapcore.Encoder
+	switch format {
+	case FORMAT_TEXT:
+		encoderConfig := zap.NewDevelopmentEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout("15:04:05")
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	case FORMAT_JSON:
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	default:
+		return nil, fmt.Errorf("unknown log format '%s', expected %s or %s", format, FORMAT_TEXT, FORMAT_JSON)
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.AddSync(output), lvl)
+	return zap.New(core), nil
+}
+
+func Network(name string) zap.Field {
+	return zap.String(NETWORK_KEY, name)
+}
+
+func NodeID(id fmt.Stringer) zap.Field {
+	return zap.Stringer(NODE_ID_KEY, id)
+}
+
+func Phase(phase string) zap.Field {
+	return zap.String(PHASE_KEY, phase)
+}
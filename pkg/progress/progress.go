@@ -0,0 +1,255 @@
+/*
+ * progress.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const SPINNER_INTERVAL = 100 * time.Millisecond
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Reporter tracks the phases of a long running command. In interactive mode the running phase
+// is shown as a spinner line, otherwise every phase transition is logged.
+// All methods are safe to call on a nil Reporter or Phase.
+type Reporter struct {
+	mu          sync.Mutex
+	out         io.Writer
+	interactive bool
+	phases      []*Phase
+	current     *Phase
+	frame       int
+	stop        chan struct{}
+}
+
+type Phase struct {
+	Name     string
+	Started  time.Time
+	Finished time.Time
+	Err      error
+	Steps    []*Phase
+
+	reporter *Reporter
+	parent   *Phase
+}
+
+func New(out io.Writer, interactive bool) *Reporter {
+	r := &Reporter{
+		out:         out,
+		interactive: interactive,
+		stop:        make(chan struct{}),
+	}
+
+	if interactive {
+		go r.spin()
+	}
+
+	return r
+}
+
+func (r *Reporter) spin() {
+	ticker := time.NewTicker(SPINNER_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			r.frame = (r.frame + 1) % len(spinnerFrames)
+			r.redraw()
+			r.mu.Unlock()
+		}
+	}
+}
+
+// redraw has to be called with the lock held
+func (r *Reporter) redraw() {
+	if r.current == nil {
+		return
+	}
+	fmt.Fprintf(r.out, "\r\033[K%s %s", spinnerFrames[r.frame], r.current.describe())
+}
+
+// clear has to be called with the lock held
+func (r *Reporter) clear() {
+	if r.current != nil {
+		fmt.Fprint(r.out, "\r\033[K")
+	}
+}
+
+// Write lets log output pass through the reporter without garbling the spinner line
+func (r *Reporter) Write(p []byte) (int, error) {
+	if r == nil {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+	n, err := r.out.Write(p)
+	r.redraw()
+	return n, err
+}
+
+// LogOutput is where output that is not part of the progress display (e.g. logs) should be written to
+func (r *Reporter) LogOutput() io.Writer {
+	if r.interactive {
+		return r
+	}
+	return r.out
+}
+
+// Start begins a new top level phase, the previous one has to be done
+func (r *Reporter) Start(name string) *Phase {
+	if r == nil {
+		return nil
+	}
+	phase := &Phase{
+		Name:     name,
+		Started:  time.Now(),
+		reporter: r,
+	}
+
+	r.mu.Lock()
+	r.phases = append(r.phases, phase)
+	r.current = phase
+	if r.interactive {
+		r.redraw()
+	}
+	r.mu.Unlock()
+
+	if !r.interactive {
+		zap.L().Info("phase started", logging.Phase(name))
+	}
+	return phase
+}
+
+// Step begins a sub phase, steps may run concurrently
+func (p *Phase) Step(name string) *Phase {
+	if p == nil {
+		return nil
+	}
+	step := &Phase{
+		Name:     name,
+		Started:  time.Now(),
+		reporter: p.reporter,
+		parent:   p,
+	}
+
+	p.reporter.mu.Lock()
+	p.Steps = append(p.Steps, step)
+	p.reporter.mu.Unlock()
+
+	return step
+}
+
+// Done finishes the phase and passes err through
+func (p *Phase) Done(err error) error {
+	if p == nil {
+		return err
+	}
+	r := p.reporter
+
+	r.mu.Lock()
+	p.Finished = time.Now()
+	p.Err = err
+	if r.interactive && p.parent == nil {
+		r.clear()
+		r.current = nil
+		mark := "✔"
+		if err != nil {
+			mark = "✘"
+		}
+		fmt.Fprintf(r.out, "%s %s\n", mark, p.describe())
+	}
+	r.mu.Unlock()
+
+	if !r.interactive {
+		fields := []zap.Field{logging.Phase(p.Name), zap.Duration("elapsed", p.Elapsed())}
+		if p.parent != nil {
+			fields[0] = logging.Phase(p.parent.Name)
+			fields = append(fields, zap.String("step", p.Name))
+		}
+		if err != nil {
+			zap.L().Error("phase failed", append(fields, zap.Error(err))...)
+		} else {
+			zap.L().Info("phase finished", fields...)
+		}
+	}
+
+	return err
+}
+
+func (p *Phase) Elapsed() time.Duration {
+	if p.Finished.IsZero() {
+		return time.Since(p.Started).Round(100 * time.Millisecond)
+	}
+	return p.Finished.Sub(p.Started).Round(100 * time.Millisecond)
+}
+
+// describe has to be called with the lock held
+func (p *Phase) describe() string {
+	desc := fmt.Sprintf("%s (%s)", p.Name, p.Elapsed())
+	if len(p.Steps) > 0 {
+		finished := 0
+		for _, s := range p.Steps {
+			if !s.Finished.IsZero() {
+				finished++
+			}
+		}
+		desc = fmt.Sprintf("%s [%d/%d] (%s)", p.Name, finished, len(p.Steps), p.Elapsed())
+	}
+	if p.Err != nil {
+		desc = fmt.Sprintf("%s: %v", desc, p.Err)
+	}
+	return desc
+}
+
+// Close stops the spinner
+func (r *Reporter) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+		r.clear()
+		r.current = nil
+	}
+}
+
+// Summary writes the elapsed time of every phase and its steps
+func (r *Reporter) Summary(w io.Writer) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	total := time.Duration(0)
+	for _, p := range r.phases {
+		total += p.Elapsed()
+		fmt.Fprintf(tw, "%s\t%s\n", p.Name, p.Elapsed())
+		for _, s := range p.Steps {
+			fmt.Fprintf(tw, "  %s\t%s\n", s.Name, s.Elapsed())
+		}
+	}
+	fmt.Fprintf(tw, "total\t%s\n", total)
+	tw.Flush()
+}
@@ -1,13 +1,28 @@
 package pkg
 
 import (
-	"fmt"
 	"os/exec"
 	"runtime/debug"
 	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	commit     string
+	commitOnce sync.Once
 )
 
-var Commit = func() string {
+// Commit is the revision the cli was built from, it is resolved on first use so errors go to the configured logger
+func Commit() string {
+	commitOnce.Do(func() {
+		commit = readCommit()
+	})
+	return commit
+}
+
+func readCommit() string {
 	if info, ok := debug.ReadBuildInfo(); ok {
 		for _, setting := range info.Settings {
 			if setting.Key == "vcs.revision" {
@@ -18,9 +33,9 @@ var Commit = func() string {
 	cmd := exec.Command("git", "rev-parse", "HEAD")
 	stdout, err := cmd.Output()
 	if err != nil {
-		fmt.Println(err)
+		zap.L().Warn("could not determine the commit", zap.Error(err))
 		return "unknown"
 	}
 
 	return strings.TrimSpace(string(stdout))
-}()
+}
@@ -0,0 +1,120 @@
+/*
+ * apply.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// applyScheme knows the kinds of all objects built in this package
+var applyScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(scheme.AddToScheme(applyScheme))
+	utilruntime.Must(promv1.AddToScheme(applyScheme))
+}
+
+// toUnstructured converts a typed object into the form sent to the api server.
+// Status and creation timestamps, also those of pod and volume claim templates, are dropped
+// so they are not claimed by the field manager.
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+
+	gvks, _, err := applyScheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvks[0])
+	stripServerFields(u.Object)
+	unstructured.RemoveNestedField(u.Object, "spec", "template", "metadata", "creationTimestamp")
+
+	claims, found, _ := unstructured.NestedSlice(u.Object, "spec", "volumeClaimTemplates")
+	if found {
+		for _, claim := range claims {
+			if claim, ok := claim.(map[string]interface{}); ok {
+				stripServerFields(claim)
+			}
+		}
+		err = unstructured.SetNestedSlice(u.Object, claims, "spec", "volumeClaimTemplates")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// stripServerFields removes the fields of an object (or template) only the api server sets
+func stripServerFields(obj map[string]interface{}) {
+	unstructured.RemoveNestedField(obj, "status")
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+}
+
+func resourceFor(dynamicClient dynamic.Interface, u *unstructured.Unstructured) dynamic.ResourceInterface {
+	gvr, _ := meta.UnsafeGuessKindToResource(u.GroupVersionKind())
+	if u.GetNamespace() == "" {
+		return dynamicClient.Resource(gvr)
+	}
+	return dynamicClient.Resource(gvr).Namespace(u.GetNamespace())
+}
+
+// applyObject server side applies obj as FIELD_MANAGER_STRING and returns the resulting object
+func applyObject(ctx context.Context, dynamicClient dynamic.Interface, obj runtime.Object, dryRun bool) (*unstructured.Unstructured, error) {
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	options := metav1.ApplyOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+		Force:        true,
+	}
+	if dryRun {
+		options.DryRun = []string{metav1.DryRunAll}
+	}
+
+	applied, err := resourceFor(dynamicClient, u).Apply(ctx, u.GetName(), u, options)
+	if err != nil {
+		return nil, fmt.Errorf("could not apply %s %s: %w", u.GetKind(), u.GetName(), err)
+	}
+	return applied, nil
+}
+
+// applyObjects server side applies objs in order
+func applyObjects(ctx context.Context, restClient *rest.Config, objs ...runtime.Object) error {
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		_, err := applyObject(ctx, dynamicClient, obj, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
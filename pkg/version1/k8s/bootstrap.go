@@ -0,0 +1,62 @@
+/*
+ * bootstrap.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// BootstrapNodes are the validators every node bootstraps from, root-0 and the first validators
+func BootstrapNodes(k8sConfig version1.K8sConfig) []string {
+	count := k8sConfig.BootstrapNodes
+	if count < 1 {
+		count = 1
+	}
+	return NodeNames(count, 0)
+}
+
+// podHost is the dns name of a node (e.g. validator-0 or api-1) from inside the cluster
+func podHost(k8sConfig version1.K8sConfig, node string) string {
+	nodeType, _, _ := strings.Cut(node, "-")
+	options := stateFullSetOptions{K8sConfig: k8sConfig, Type: nodeType}
+	return fmt.Sprintf("%s.%s.%s.svc", k8sConfig.PrefixWith(node), headlessServiceName(options), k8sConfig.Namespace)
+}
+
+// bootstrapEnv passes the bootstrap nodes to start.sh, BOOTSTRAP_HOSTS lists their dns names
+// and BOOTSTRAP_ID_<i> holds the node id of the i-th of them
+func bootstrapEnv(k8sConfig version1.K8sConfig) []corev1.EnvVar {
+	nodes := BootstrapNodes(k8sConfig)
+	hosts := make([]string, 0, len(nodes))
+	env := []corev1.EnvVar{}
+
+	for i, node := range nodes {
+		hosts = append(hosts, podHost(k8sConfig, node))
+
+		// the names come from NodeNames, they are always valid
+		index, _ := stakerIndex(node)
+		env = append(env, corev1.EnvVar{
+			Name: fmt.Sprintf("BOOTSTRAP_ID_%d", i),
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: fmt.Sprintf("%s-%d", k8sConfig.K8sPrefix, index),
+					},
+					Key: NODE_ID_KEY,
+				},
+			},
+		})
+	}
+
+	return append(env, corev1.EnvVar{
+		Name:  "BOOTSTRAP_HOSTS",
+		Value: strings.Join(hosts, " "),
+	})
+}
@@ -0,0 +1,210 @@
+/*
+ * connection.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+type ConnectionMode string
+
+const (
+	CONNECTION_PORT_FORWARD ConnectionMode = "port-forward"
+	CONNECTION_INGRESS      ConnectionMode = "ingress"
+	CONNECTION_SERVICE      ConnectionMode = "service"
+)
+
+const NODE_API_PORT = 9650
+const CONNECTION_TIMEOUT = 30 * time.Second
+
+var CONNECTION_MODES = []ConnectionMode{CONNECTION_PORT_FORWARD, CONNECTION_INGRESS, CONNECTION_SERVICE}
+
+func ParseConnectionMode(mode string) (ConnectionMode, error) {
+	for _, m := range CONNECTION_MODES {
+		if string(m) == mode {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown connection mode '%s', expected one of %v", mode, CONNECTION_MODES)
+}
+
+// parseEnum returns value if it is one of allowed, kind names the value in the error
+func parseEnum(kind string, value string, allowed []string) (string, error) {
+	for _, a := range allowed {
+		if a == value {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unknown %s '%s', expected one of %v", kind, value, allowed)
+}
+
+// NodeConnection sends api calls to the nodes of one StatefulSet (e.g. "root" or "api")
+type NodeConnection struct {
+	BaseURL string
+	client  *http.Client
+	stop    chan struct{}
+}
+
+// ConnectToNode opens a connection to the api of the nodes of type nodeType.
+// port-forward talks to the first pod directly, ingress uses the public url of the network
+// and service uses the cluster internal dns name (only works from inside the cluster)
+func ConnectToNode(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, mode ConnectionMode, nodeType string) (*NodeConnection, error) {
+	conn := &NodeConnection{
+		client: &http.Client{Timeout: CONNECTION_TIMEOUT},
+	}
+
+	switch mode {
+	case CONNECTION_PORT_FORWARD:
+		localPort, stop, err := portForward(restClient, k8sConfig.Namespace, k8sConfig.PrefixWith(fmt.Sprintf("%s-0", nodeType)))
+		if err != nil {
+			return nil, err
+		}
+		conn.stop = stop
+		conn.BaseURL = fmt.Sprintf("http://localhost:%d", localPort)
+	case CONNECTION_INGRESS:
+		if k8sConfig.Domain == "" {
+			return nil, fmt.Errorf("connection mode %s requires a domain", mode)
+		}
+		client, err := publicClient(ctx, restClient, k8sConfig)
+		if err != nil {
+			return nil, err
+		}
+		conn.client = client
+		conn.BaseURL = PublicURL(k8sConfig)
+		if nodeType == "root" {
+			conn.BaseURL += "/static"
+		}
+	case CONNECTION_SERVICE:
+		conn.BaseURL = fmt.Sprintf("http://%s.%s.svc:%d", k8sConfig.PrefixWith(nodeType), k8sConfig.Namespace, NODE_API_PORT)
+	default:
+		return nil, fmt.Errorf("unknown connection mode '%s'", mode)
+	}
+
+	return conn, nil
+}
+
+// ConnectToPod opens a connection to the api of a single node (e.g. validator-1).
+// port-forward talks to the pod directly, ingress needs the per node routes (--node-routes)
+// and service uses the dns name of the pod (only works from inside the cluster)
+func ConnectToPod(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, mode ConnectionMode, node string) (*NodeConnection, error) {
+	conn := &NodeConnection{
+		client: &http.Client{Timeout: CONNECTION_TIMEOUT},
+	}
+
+	switch mode {
+	case CONNECTION_PORT_FORWARD:
+		localPort, stop, err := portForward(restClient, k8sConfig.Namespace, k8sConfig.PrefixWith(node))
+		if err != nil {
+			return nil, err
+		}
+		conn.stop = stop
+		conn.BaseURL = fmt.Sprintf("http://localhost:%d", localPort)
+	case CONNECTION_INGRESS:
+		if k8sConfig.Domain == "" {
+			return nil, fmt.Errorf("connection mode %s requires a domain", mode)
+		}
+		client, err := publicClient(ctx, restClient, k8sConfig)
+		if err != nil {
+			return nil, err
+		}
+		conn.client = client
+		conn.BaseURL = PublicURL(k8sConfig) + NodePath(node)
+	case CONNECTION_SERVICE:
+		conn.BaseURL = fmt.Sprintf("http://%s:%d", podHost(k8sConfig, node), NODE_API_PORT)
+	default:
+		return nil, fmt.Errorf("unknown connection mode '%s'", mode)
+	}
+
+	return conn, nil
+}
+
+// Close stops the port forwarding if there is one
+func (c *NodeConnection) Close() {
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// Post sends a json payload to the endpoint (e.g. "/ext/bc/P") and returns the response body
+func (c *NodeConnection) Post(ctx context.Context, endpoint string, payload io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return ioutil.ReadAll(res.Body)
+}
+
+func portForward(restClient *rest.Config, namespace string, podName string) (uint16, chan struct{}, error) {
+	roundTripper, upgrader, err := spdy.RoundTripperFor(restClient)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	serverURL, err := url.Parse(restClient.Host)
+	if err != nil {
+		return 0, nil, err
+	}
+	if serverURL.Scheme == "" || serverURL.Host == "" {
+		serverURL = &url.URL{Scheme: "https", Host: strings.TrimSuffix(restClient.Host, "/")}
+	}
+	serverURL.Path = strings.TrimSuffix(serverURL.Path, "/") + fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, podName)
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, serverURL)
+
+	stopChan, readyChan := make(chan struct{}, 1), make(chan struct{}, 1)
+	out, errOut := new(strings.Builder), new(strings.Builder)
+
+	// a local port of 0 lets the os choose a free port
+	forwarder, err := portforward.New(dialer, []string{fmt.Sprintf("0:%d", NODE_API_PORT)}, stopChan, readyChan, out, errOut)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	forwardErr := make(chan error, 1)
+	go func() {
+		// Locks until stopChan is closed.
+		forwardErr <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-forwardErr:
+		if err == nil {
+			err = fmt.Errorf("port forwarding to %s stopped unexpectedly: %s", podName, errOut.String())
+		}
+		return 0, nil, err
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		close(stopChan)
+		return 0, nil, err
+	}
+
+	return ports[0].Local, stopChan, nil
+}
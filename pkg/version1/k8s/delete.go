@@ -0,0 +1,172 @@
+/*
+ * delete.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const DELETION_CHECK_INTERVAL = 2 * time.Second
+
+var persistentVolumeClaims = schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}
+
+// networkResources are the kinds of all objects labeled with the network, in deletion order
+var networkResources = []schema.GroupVersionResource{
+	{Group: "apps", Version: "v1", Resource: "statefulsets"},
+	{Group: "batch", Version: "v1", Resource: "jobs"},
+	{Version: "v1", Resource: "pods"},
+	{Version: "v1", Resource: "services"},
+	{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	{Group: "traefik.io", Version: "v1alpha1", Resource: "ingressroutes"},
+	{Group: "traefik.io", Version: "v1alpha1", Resource: "middlewares"},
+	{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"},
+	{Group: "cert-manager.io", Version: "v1", Resource: "certificates"},
+	{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"},
+	{Version: "v1", Resource: "configmaps"},
+	{Version: "v1", Resource: "secrets"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"},
+	{Version: "v1", Resource: "serviceaccounts"},
+	persistentVolumeClaims,
+}
+
+// NetworkObject identifies a live object belonging to a network
+type NetworkObject struct {
+	Resource string
+	Name     string
+}
+
+func (o NetworkObject) String() string {
+	return fmt.Sprintf("%s/%s", o.Resource, o.Name)
+}
+
+func deletableResources(keepDisks bool) []schema.GroupVersionResource {
+	if !keepDisks {
+		return networkResources
+	}
+	resources := make([]schema.GroupVersionResource, 0, len(networkResources))
+	for _, gvr := range networkResources {
+		if gvr != persistentVolumeClaims {
+			resources = append(resources, gvr)
+		}
+	}
+	return resources
+}
+
+// ListNetworkObjects returns all objects DeleteCluster would remove
+func ListNetworkObjects(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, keepDisks bool) ([]NetworkObject, error) {
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []NetworkObject{}
+	for _, gvr := range deletableResources(keepDisks) {
+		list, err := dynamicClient.Resource(gvr).Namespace(k8sConfig.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: selector.String(),
+		})
+		// the crds of monitoring and the other ingress providers are not installed on every cluster
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			objects = append(objects, NetworkObject{Resource: gvr.Resource, Name: item.GetName()})
+		}
+	}
+	return objects, nil
+}
+
+// DeleteCluster deletes all objects labeled with the network, it does not wait for them to be gone
+func DeleteCluster(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, keepDisks bool) error {
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
+	if err != nil {
+		return err
+	}
+
+	gracePeriod := int64(0)
+	backgroundPropagation := metav1.DeletePropagationBackground
+	for _, gvr := range deletableResources(keepDisks) {
+		err = dynamicClient.Resource(gvr).Namespace(k8sConfig.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+			PropagationPolicy:  &backgroundPropagation,
+		}, metav1.ListOptions{
+			LabelSelector: selector.String(),
+		})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteNamespace deletes the namespace of the network with everything in it
+func DeleteNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	err := clientset.CoreV1().Namespaces().Delete(ctx, k8sConfig.Namespace, metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// WaitForDeletion blocks until the objects of the network (or the whole namespace) are gone
+func WaitForDeletion(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, keepDisks bool, namespace bool) error {
+	ticker := time.NewTicker(DELETION_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		if namespace {
+			_, err := clientset.CoreV1().Namespaces().Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+			if k8sErrors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			zap.L().Debug("waiting for namespace to terminate", zap.String("namespace", k8sConfig.Namespace))
+		} else {
+			remaining, err := ListNetworkObjects(ctx, restClient, k8sConfig, keepDisks)
+			if err != nil {
+				return err
+			}
+			if len(remaining) == 0 {
+				return nil
+			}
+			zap.L().Debug("waiting for objects to terminate", zap.Int("remaining", len(remaining)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not wait for the deletion of %s: %w", k8sConfig.Namespace, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
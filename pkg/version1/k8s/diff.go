@@ -0,0 +1,367 @@
+/*
+ * diff.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"github.com/ava-labs/avalanchego/genesis"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fields the api server maintains itself, they never count as drift
+var ignoredFields = [][]string{
+	{"status"},
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "uid"},
+	{"metadata", "generation"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "selfLink"},
+}
+
+// ObjectDiff describes how a live object differs from what camktncr would apply
+type ObjectDiff struct {
+	Kind    string
+	Name    string
+	Missing bool
+	Changes []FieldChange
+	// field managers other than camktncr that own one of the changed fields, e.g. kubectl-edit
+	OtherManagers []string
+}
+
+type FieldChange struct {
+	Path    string
+	Live    interface{}
+	Desired interface{}
+	// field managers other than camktncr that own the field
+	Managers []string
+
+	segments []string
+}
+
+func (d ObjectDiff) HasDrift() bool {
+	return d.Missing || len(d.Changes) > 0
+}
+
+// LiveGenesisStartTime returns the start time of the genesis of a running network, found is false if there is none
+func LiveGenesisStartTime(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (uint64, bool, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, k8sConfig.K8sPrefix, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	raw, ok := configMap.BinaryData["genesis.json"]
+	if !ok {
+		return 0, false, nil
+	}
+
+	genesisConfig := genesis.UnparsedConfig{}
+	err = json.Unmarshal(raw, &genesisConfig)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not parse the genesis of the running network: %w", err)
+	}
+	return genesisConfig.StartTime, true, nil
+}
+
+// DesiredNetworkObjects builds every object create applies for a network, in the same order
+func DesiredNetworkObjects(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, ownership Ownership, genesisConfig genesis.UnparsedConfig, stakers []version1.Staker, numValidators int32, numApiNodes int32) ([]runtime.Object, error) {
+	k8sConfig.NumStakers = int32(len(stakers))
+	objs := []runtime.Object{buildNamespace(k8sConfig, ownership)}
+
+	copied := []string{k8sConfig.PullSecretName}
+	if k8sConfig.TLS.Mode == TLS_SECRET {
+		copied = append(copied, k8sConfig.TLSSecretName)
+	}
+	for _, secretName := range copied {
+		secret, err := clientset.CoreV1().Secrets("default").Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, buildSecretCopy(secret, k8sConfig))
+	}
+	objs = append(objs, buildStakerSecrets(stakers, k8sConfig)...)
+
+	networkConfigMap, err := buildNetworkConfigMap(genesisConfig, k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+	scriptsConfigMap, err := buildScriptsConfigMap(k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+	nodeConfigMap, err := buildNodeConfigMap(k8sConfig, genesisConfig)
+	if err != nil {
+		return nil, err
+	}
+	objs = append(objs, networkConfigMap, scriptsConfigMap, nodeConfigMap)
+
+	objs = append(objs, buildStatefulSetObjects(rootNodeOptions(k8sConfig))...)
+	objs = append(objs, buildStatefulSetObjects(validatorsOptions(k8sConfig, numValidators-1))...)
+	objs = append(objs, buildStatefulSetObjects(apiNodesOptions(k8sConfig, numApiNodes))...)
+	ingresses, err := buildIngresses(k8sConfig, numValidators, numApiNodes)
+	if err != nil {
+		return nil, err
+	}
+	objs = append(objs, ingresses...)
+
+	return objs, nil
+}
+
+// DiffObjects compares the live state of objs with the result of a server side dry-run apply of them.
+// The dry-run includes defaulting and admission, so only changes an apply would actually make are reported.
+func DiffObjects(ctx context.Context, restClient *rest.Config, objs []runtime.Object) ([]ObjectDiff, error) {
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]ObjectDiff, 0, len(objs))
+	for _, obj := range objs {
+		desired, err := toUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		diff := ObjectDiff{
+			Kind: desired.GetKind(),
+			Name: desired.GetName(),
+		}
+
+		live, err := resourceFor(dynamicClient, desired).Get(ctx, desired.GetName(), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			diff.Missing = true
+			diffs = append(diffs, diff)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		applied, err := applyObject(ctx, dynamicClient, desired, true)
+		if err != nil {
+			return nil, err
+		}
+
+		liveContent := withoutIgnoredFields(live)
+		appliedContent := withoutIgnoredFields(applied)
+		diffFields(nil, liveContent, appliedContent, &diff.Changes)
+		diff.OtherManagers = attributeChanges(live, diff.Changes)
+
+		// never print secret values
+		if diff.Kind == "Secret" {
+			for i := range diff.Changes {
+				diff.Changes[i].Live = maskValue(diff.Changes[i].Live)
+				diff.Changes[i].Desired = maskValue(diff.Changes[i].Desired)
+			}
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
+
+func withoutIgnoredFields(u *unstructured.Unstructured) map[string]interface{} {
+	content := runtime.DeepCopyJSON(u.Object)
+	for _, fields := range ignoredFields {
+		unstructured.RemoveNestedField(content, fields...)
+	}
+	return content
+}
+
+// attributeChanges sets the managers other than camktncr that own each changed field
+// and returns all of them, fields nobody else touched have no managers
+func attributeChanges(u *unstructured.Unstructured, changes []FieldChange) []string {
+	owned := map[string][][]string{}
+	for _, entry := range u.GetManagedFields() {
+		// status updates of controllers are not changes to the spec
+		if entry.Manager == FIELD_MANAGER_STRING || entry.Subresource != "" || entry.FieldsV1 == nil {
+			continue
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		owned[entry.Manager] = append(owned[entry.Manager], fieldPaths(nil, fields)...)
+	}
+
+	seen := map[string]bool{}
+	managers := []string{}
+	for i := range changes {
+		for manager, paths := range owned {
+			for _, path := range paths {
+				if overlaps(path, changes[i].segments) {
+					changes[i].Managers = append(changes[i].Managers, manager)
+					if !seen[manager] {
+						seen[manager] = true
+						managers = append(managers, manager)
+					}
+					break
+				}
+			}
+		}
+		sort.Strings(changes[i].Managers)
+	}
+	sort.Strings(managers)
+	return managers
+}
+
+// fieldPaths flattens a FieldsV1 set into the paths of its leaves, in the form diffFields uses.
+// Elements of lists keyed by anything but a name and of sets match every element ("*").
+func fieldPaths(prefix []string, fields map[string]interface{}) [][]string {
+	paths := [][]string{}
+	for key, children := range fields {
+		if key == "." {
+			continue
+		}
+
+		segment := "*"
+		switch {
+		case strings.HasPrefix(key, "f:"):
+			segment = strings.TrimPrefix(key, "f:")
+		case strings.HasPrefix(key, "i:"):
+			segment = fmt.Sprintf("[%s]", strings.TrimPrefix(key, "i:"))
+		case strings.HasPrefix(key, "k:"):
+			elemKey := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(key, "k:")), &elemKey); err == nil {
+				if name, ok := elemKey["name"].(string); ok {
+					segment = fmt.Sprintf("[%s]", name)
+				}
+			}
+		}
+
+		// only leaves are owned values, the other entries just lead to them
+		path := append(append([]string{}, prefix...), segment)
+		children, _ := children.(map[string]interface{})
+		if len(children) == 0 {
+			paths = append(paths, path)
+			continue
+		}
+		paths = append(paths, fieldPaths(path, children)...)
+	}
+	return paths
+}
+
+// overlaps is true if one path contains the other, e.g. a manager owning a container owns all its fields
+func overlaps(owned []string, changed []string) bool {
+	length := len(owned)
+	if len(changed) < length {
+		length = len(changed)
+	}
+	for i := 0; i < length; i++ {
+		if owned[i] != "*" && owned[i] != changed[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func maskValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return "(hidden)"
+}
+
+// diffFields collects the differences between live and desired, lists of named elements
+// (containers, ports, env, ...) are matched by name instead of by position
+func diffFields(path []string, live interface{}, desired interface{}, changes *[]FieldChange) {
+	liveMap, liveIsMap := live.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if liveIsMap && desiredIsMap {
+		keys := map[string]bool{}
+		for k := range liveMap {
+			keys[k] = true
+		}
+		for k := range desiredMap {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		for _, k := range sorted {
+			diffFields(append(path, k), liveMap[k], desiredMap[k], changes)
+		}
+		return
+	}
+
+	liveList, liveIsList := live.([]interface{})
+	desiredList, desiredIsList := desired.([]interface{})
+	if liveIsList && desiredIsList {
+		liveNamed, liveOk := byName(liveList)
+		desiredNamed, desiredOk := byName(desiredList)
+		if liveOk && desiredOk {
+			diffFields(path, liveNamed, desiredNamed, changes)
+			return
+		}
+
+		length := len(liveList)
+		if len(desiredList) > length {
+			length = len(desiredList)
+		}
+		for i := 0; i < length; i++ {
+			var l, d interface{}
+			if i < len(liveList) {
+				l = liveList[i]
+			}
+			if i < len(desiredList) {
+				d = desiredList[i]
+			}
+			diffFields(append(path, fmt.Sprintf("[%d]", i)), l, d, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(live, desired) {
+		*changes = append(*changes, FieldChange{
+			Path:     strings.ReplaceAll(strings.Join(path, "."), ".[", "["),
+			Live:     live,
+			Desired:  desired,
+			segments: append([]string{}, path...),
+		})
+	}
+}
+
+// byName turns a list whose elements all have a unique name into a map keyed by "[<name>]"
+func byName(list []interface{}) (map[string]interface{}, bool) {
+	named := make(map[string]interface{}, len(list))
+	for _, elem := range list {
+		m, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		name, ok := m["name"].(string)
+		if !ok {
+			return nil, false
+		}
+		key := fmt.Sprintf("[%s]", name)
+		if _, exists := named[key]; exists {
+			return nil, false
+		}
+		named[key] = elem
+	}
+	return named, true
+}
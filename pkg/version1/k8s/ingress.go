@@ -0,0 +1,523 @@
+/*
+ * ingress.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"go.uber.org/zap"
+	networkingv1 "k8s.io/api/networking/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	INGRESS_NGINX   = "nginx"
+	INGRESS_TRAEFIK = "traefik"
+	INGRESS_GATEWAY = "gateway"
+)
+
+const TRAEFIK_API_VERSION = "traefik.io/v1alpha1"
+const GATEWAY_API_VERSION = "gateway.networking.k8s.io/v1"
+const CERT_MANAGER_API_VERSION = "cert-manager.io/v1"
+
+// IngressProvider publishes the network under https://<namespace>.<domain>, / is balanced over the api-nodes
+// and /static always reaches the root node with the prefix stripped.
+// Each of the nodes (e.g. validator-0) is published under /nodes/<node>/ the same way.
+type IngressProvider interface {
+	Build(k8sConfig version1.K8sConfig, nodes []string) []runtime.Object
+}
+
+// INGRESS_PROVIDERS are the ingress implementations selectable with K8sConfig.Ingress.Provider
+var INGRESS_PROVIDERS = map[string]IngressProvider{
+	INGRESS_NGINX:   nginxIngress{},
+	INGRESS_TRAEFIK: traefikIngress{},
+	INGRESS_GATEWAY: gatewayRoute{},
+}
+
+var INGRESS_PROVIDER_NAMES = []string{INGRESS_NGINX, INGRESS_TRAEFIK, INGRESS_GATEWAY}
+
+func ParseIngressProvider(provider string) (string, error) {
+	return parseEnum("ingress provider", provider, INGRESS_PROVIDER_NAMES)
+}
+
+func buildIngresses(k8sConfig version1.K8sConfig, numValidators int32, numApiNodes int32) ([]runtime.Object, error) {
+	name := k8sConfig.Ingress.Provider
+	if name == "" {
+		name = INGRESS_NGINX
+	}
+	provider, ok := INGRESS_PROVIDERS[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown ingress provider '%s'", name)
+	}
+
+	var nodes []string
+	if k8sConfig.Exposure.NodeRoutes {
+		nodes = NodeNames(numValidators, numApiNodes)
+	}
+	return provider.Build(k8sConfig, nodes), nil
+}
+
+var (
+	ingressesResource     = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	ingressRoutesResource = schema.GroupVersionResource{Group: "traefik.io", Version: "v1alpha1", Resource: "ingressroutes"}
+	httpRoutesResource    = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+)
+
+// ingressResources are the kinds of all objects the ingress providers build
+var ingressResources = []schema.GroupVersionResource{
+	ingressesResource,
+	ingressRoutesResource,
+	{Group: "traefik.io", Version: "v1alpha1", Resource: "middlewares"},
+	httpRoutesResource,
+	{Group: "cert-manager.io", Version: "v1", Resource: "certificates"},
+}
+
+// pruneIngresses deletes the ingress objects of the network that are not in keep.
+// Objects owned by a controller, e.g. the Certificate cert-manager creates for an Ingress, are left alone.
+func pruneIngresses(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, keep []runtime.Object) error {
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	kept := map[string]bool{}
+	for _, obj := range keep {
+		u, err := toUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		gvr, _ := meta.UnsafeGuessKindToResource(u.GroupVersionKind())
+		kept[gvr.GroupResource().String()+"/"+u.GetName()] = true
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
+	if err != nil {
+		return err
+	}
+	for _, gvr := range ingressResources {
+		resource := dynamicClient.Resource(gvr).Namespace(k8sConfig.Namespace)
+		list, err := resource.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		// the crds of the other providers are not installed on every cluster
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, item := range list.Items {
+			if kept[gvr.GroupResource().String()+"/"+item.GetName()] || metav1.GetControllerOf(&item) != nil {
+				continue
+			}
+			zap.L().Info("deleting ingress object of an unselected provider", zap.String("resource", gvr.Resource), zap.String("name", item.GetName()))
+			err = resource.Delete(ctx, item.GetName(), metav1.DeleteOptions{})
+			if err != nil && !k8sErrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var traefikHostPattern = regexp.MustCompile("Host\\(`([^`]+)`\\)")
+
+// ingressHost returns the public host of an ingress object of any provider, empty if it has none
+func ingressHost(obj unstructured.Unstructured) string {
+	switch obj.GetKind() {
+	case "Ingress":
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		for _, rule := range rules {
+			if rule, ok := rule.(map[string]interface{}); ok {
+				if host, ok := rule["host"].(string); ok && host != "" {
+					return host
+				}
+			}
+		}
+	case "IngressRoute":
+		routes, _, _ := unstructured.NestedSlice(obj.Object, "spec", "routes")
+		for _, route := range routes {
+			if route, ok := route.(map[string]interface{}); ok {
+				match, _ := route["match"].(string)
+				if host := traefikHostPattern.FindStringSubmatch(match); host != nil {
+					return host[1]
+				}
+			}
+		}
+	case "HTTPRoute":
+		hostnames, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "hostnames")
+		if len(hostnames) > 0 {
+			return hostnames[0]
+		}
+	}
+	return ""
+}
+
+// NodePath is the path a single node is published under
+func NodePath(node string) string {
+	return fmt.Sprintf("/nodes/%s", node)
+}
+
+func publicHost(k8sConfig version1.K8sConfig) string {
+	return fmt.Sprintf("%s.%s", k8sConfig.Namespace, k8sConfig.Domain)
+}
+
+// nginxIngress uses two Ingress objects as the rewrite annotation applies to all paths of an Ingress
+type nginxIngress struct{}
+
+func (nginxIngress) Build(k8sConfig version1.K8sConfig, nodes []string) []runtime.Object {
+	annotations := ingressAnnotations(k8sConfig)
+	secretName := tlsSecretName(k8sConfig)
+	pathType := networkingv1.PathTypePrefix
+	staticAnnotations := make(map[string]string)
+	for k, v := range annotations {
+		staticAnnotations[k] = v
+	}
+	staticAnnotations["nginx.ingress.kubernetes.io/rewrite-target"] = "/$2"
+
+	nginx := k8sConfig.Ingress.ClassName
+	if nginx == "" {
+		nginx = INGRESS_NGINX
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        k8sConfig.PrefixWith("ingress"),
+			Namespace:   k8sConfig.Namespace,
+			Annotations: annotations,
+			Labels:      k8sConfig.Labels,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &nginx,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: publicHost(k8sConfig),
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: k8sConfig.PrefixWith("api"),
+											Port: networkingv1.ServiceBackendPort{
+												Name: "rpc",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			TLS: []networkingv1.IngressTLS{
+				{
+					Hosts: []string{
+						publicHost(k8sConfig),
+					},
+					SecretName: secretName,
+				},
+			},
+		},
+	}
+
+	staticIngress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        k8sConfig.PrefixWith("ingress-static"),
+			Namespace:   k8sConfig.Namespace,
+			Annotations: staticAnnotations,
+			Labels:      k8sConfig.Labels,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &nginx,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: publicHost(k8sConfig),
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/static(/|$)(.*)",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: k8sConfig.PrefixWith("root"),
+											Port: networkingv1.ServiceBackendPort{
+												Name: "rpc",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			TLS: []networkingv1.IngressTLS{
+				{
+					Hosts: []string{
+						publicHost(k8sConfig),
+					},
+					SecretName: secretName,
+				},
+			},
+		},
+	}
+
+	objs := []runtime.Object{staticIngress, ingress}
+
+	// the nodes share the rewrite of the static ingress
+	if len(nodes) > 0 {
+		nodesIngress := staticIngress.DeepCopy()
+		nodesIngress.Name = k8sConfig.PrefixWith("ingress-nodes")
+		paths := []networkingv1.HTTPIngressPath{}
+		for _, node := range nodes {
+			paths = append(paths, networkingv1.HTTPIngressPath{
+				Path:     NodePath(node) + "(/|$)(.*)",
+				PathType: &pathType,
+				Backend: networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{
+						Name: k8sConfig.PrefixWith(node),
+						Port: networkingv1.ServiceBackendPort{
+							Name: "rpc",
+						},
+					},
+				},
+			})
+		}
+		nodesIngress.Spec.Rules[0].HTTP.Paths = paths
+		objs = append(objs, nodesIngress)
+	}
+
+	// plain http
+	if secretName == "" {
+		for _, obj := range objs {
+			obj.(*networkingv1.Ingress).Spec.TLS = nil
+		}
+	}
+
+	return objs
+}
+
+// traefikIngress uses an IngressRoute, /static is stripped by a Middleware.
+// Traefik does not request certificates from cert-manager by itself, so a Certificate is added in cert-manager mode.
+type traefikIngress struct{}
+
+func (traefikIngress) Build(k8sConfig version1.K8sConfig, nodes []string) []runtime.Object {
+	host := publicHost(k8sConfig)
+	secretName := tlsSecretName(k8sConfig)
+
+	middleware := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": TRAEFIK_API_VERSION,
+		"kind":       "Middleware",
+		"spec": map[string]interface{}{
+			"stripPrefix": map[string]interface{}{
+				"prefixes": []interface{}{"/static"},
+			},
+		},
+	}}
+	middleware.SetName(k8sConfig.PrefixWith("strip-static"))
+	middleware.SetNamespace(k8sConfig.Namespace)
+	middleware.SetLabels(k8sConfig.Labels)
+
+	route := func(match string, service string, middlewares []interface{}) interface{} {
+		r := map[string]interface{}{
+			"kind":  "Rule",
+			"match": match,
+			"services": []interface{}{
+				map[string]interface{}{
+					"name": k8sConfig.PrefixWith(service),
+					"port": int64(NODE_API_PORT),
+				},
+			},
+		}
+		if len(middlewares) > 0 {
+			r["middlewares"] = middlewares
+		}
+		return r
+	}
+
+	entryPoints := []interface{}{}
+	for _, entryPoint := range k8sConfig.Ingress.EntryPoints {
+		entryPoints = append(entryPoints, entryPoint)
+	}
+
+	routes := []interface{}{
+		route(fmt.Sprintf("Host(`%s`) && (Path(`/static`) || PathPrefix(`/static/`))", host), "root", []interface{}{
+			map[string]interface{}{"name": middleware.GetName()},
+		}),
+		route(fmt.Sprintf("Host(`%s`)", host), "api", nil),
+	}
+	objs := []runtime.Object{middleware}
+
+	if len(nodes) > 0 {
+		nodesMiddleware := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": TRAEFIK_API_VERSION,
+			"kind":       "Middleware",
+			"spec": map[string]interface{}{
+				"stripPrefixRegex": map[string]interface{}{
+					"regex": []interface{}{"^/nodes/[^/]+"},
+				},
+			},
+		}}
+		nodesMiddleware.SetName(k8sConfig.PrefixWith("strip-node"))
+		nodesMiddleware.SetNamespace(k8sConfig.Namespace)
+		nodesMiddleware.SetLabels(k8sConfig.Labels)
+		objs = append(objs, nodesMiddleware)
+
+		for _, node := range nodes {
+			// a plain prefix of validator-1 would also match validator-10
+			match := fmt.Sprintf("Host(`%s`) && (Path(`%s`) || PathPrefix(`%s/`))", host, NodePath(node), NodePath(node))
+			routes = append(routes, route(match, node, []interface{}{
+				map[string]interface{}{"name": nodesMiddleware.GetName()},
+			}))
+		}
+	}
+
+	spec := map[string]interface{}{
+		"entryPoints": entryPoints,
+		"routes":      routes,
+	}
+	if secretName != "" {
+		spec["tls"] = map[string]interface{}{
+			"secretName": secretName,
+		}
+	}
+
+	ingressRoute := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": TRAEFIK_API_VERSION,
+		"kind":       "IngressRoute",
+		"spec":       spec,
+	}}
+	ingressRoute.SetName(k8sConfig.PrefixWith("ingress"))
+	ingressRoute.SetNamespace(k8sConfig.Namespace)
+	ingressRoute.SetLabels(k8sConfig.Labels)
+	if k8sConfig.Ingress.ClassName != "" {
+		ingressRoute.SetAnnotations(map[string]string{"kubernetes.io/ingress.class": k8sConfig.Ingress.ClassName})
+	}
+
+	objs = append(objs, ingressRoute)
+	if k8sConfig.TLS.Mode == TLS_CERT_MANAGER {
+		objs = append(objs, buildCertificate(k8sConfig, host, secretName))
+	}
+	return objs
+}
+
+// buildCertificate requests the certificate cert-manager would request for an Ingress of the network
+func buildCertificate(k8sConfig version1.K8sConfig, host string, secretName string) *unstructured.Unstructured {
+	issuerKind := k8sConfig.TLS.IssuerKind
+	if issuerKind == "" {
+		issuerKind = "ClusterIssuer"
+	}
+
+	certificate := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": CERT_MANAGER_API_VERSION,
+		"kind":       "Certificate",
+		"spec": map[string]interface{}{
+			"secretName": secretName,
+			"dnsNames":   []interface{}{host},
+			"issuerRef": map[string]interface{}{
+				"name": k8sConfig.TLS.Issuer,
+				"kind": issuerKind,
+			},
+		},
+	}}
+	certificate.SetName(secretName)
+	certificate.SetNamespace(k8sConfig.Namespace)
+	certificate.SetLabels(k8sConfig.Labels)
+	return certificate
+}
+
+// gatewayRoute attaches an HTTPRoute to an existing Gateway, tls is terminated by the listeners of the Gateway
+type gatewayRoute struct{}
+
+func (gatewayRoute) Build(k8sConfig version1.K8sConfig, nodes []string) []runtime.Object {
+	parentRef := map[string]interface{}{
+		"name": k8sConfig.Ingress.GatewayName,
+	}
+	if k8sConfig.Ingress.GatewayNamespace != "" {
+		parentRef["namespace"] = k8sConfig.Ingress.GatewayNamespace
+	}
+	if k8sConfig.Ingress.GatewaySection != "" {
+		parentRef["sectionName"] = k8sConfig.Ingress.GatewaySection
+	}
+
+	backend := func(service string) []interface{} {
+		return []interface{}{
+			map[string]interface{}{
+				"name": k8sConfig.PrefixWith(service),
+				"port": int64(NODE_API_PORT),
+			},
+		}
+	}
+	pathPrefix := func(prefix string) []interface{} {
+		return []interface{}{
+			map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":  "PathPrefix",
+					"value": prefix,
+				},
+			},
+		}
+	}
+
+	stripPrefix := []interface{}{
+		map[string]interface{}{
+			"type": "URLRewrite",
+			"urlRewrite": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":               "ReplacePrefixMatch",
+					"replacePrefixMatch": "/",
+				},
+			},
+		},
+	}
+
+	rules := []interface{}{
+		map[string]interface{}{
+			"matches":     pathPrefix("/static"),
+			"filters":     stripPrefix,
+			"backendRefs": backend("root"),
+		},
+		map[string]interface{}{
+			"matches":     pathPrefix("/"),
+			"backendRefs": backend("api"),
+		},
+	}
+	// PathPrefix matches whole path elements, /nodes/validator-1 does not match /nodes/validator-10
+	for _, node := range nodes {
+		rules = append(rules, map[string]interface{}{
+			"matches":     pathPrefix(NodePath(node)),
+			"filters":     stripPrefix,
+			"backendRefs": backend(node),
+		})
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": GATEWAY_API_VERSION,
+		"kind":       "HTTPRoute",
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{parentRef},
+			"hostnames":  []interface{}{publicHost(k8sConfig)},
+			"rules":      rules,
+		},
+	}}
+	route.SetName(k8sConfig.PrefixWith("ingress"))
+	route.SetNamespace(k8sConfig.Namespace)
+	route.SetLabels(k8sConfig.Labels)
+	return []runtime.Object{route}
+}
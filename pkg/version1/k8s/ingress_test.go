@@ -0,0 +1,87 @@
+/*
+ * ingress_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBuildIngresses(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   string
+		tlsMode    string
+		nodeRoutes bool
+		want       []string
+		wantTLS    bool
+		wantErr    bool
+	}{
+		{"default is nginx", "", TLS_CERT_MANAGER, false, []string{"Ingress/net-ingress-static", "Ingress/net-ingress"}, true, false},
+		{"nginx", INGRESS_NGINX, TLS_SECRET, false, []string{"Ingress/net-ingress-static", "Ingress/net-ingress"}, true, false},
+		{"nginx node routes", INGRESS_NGINX, TLS_CERT_MANAGER, true, []string{"Ingress/net-ingress-static", "Ingress/net-ingress", "Ingress/net-ingress-nodes"}, true, false},
+		{"nginx plain http", INGRESS_NGINX, TLS_NONE, true, []string{"Ingress/net-ingress-static", "Ingress/net-ingress", "Ingress/net-ingress-nodes"}, false, false},
+		{"traefik", INGRESS_TRAEFIK, TLS_CERT_MANAGER, false, []string{"Middleware/net-strip-static", "IngressRoute/net-ingress", "Certificate/net-tls-secret"}, true, false},
+		{"traefik self-signed", INGRESS_TRAEFIK, TLS_SELF_SIGNED, false, []string{"Middleware/net-strip-static", "IngressRoute/net-ingress"}, true, false},
+		{"traefik node routes", INGRESS_TRAEFIK, TLS_SECRET, true, []string{"Middleware/net-strip-static", "Middleware/net-strip-node", "IngressRoute/net-ingress"}, true, false},
+		{"traefik plain http", INGRESS_TRAEFIK, TLS_NONE, false, []string{"Middleware/net-strip-static", "IngressRoute/net-ingress"}, false, false},
+		// the listeners of the gateway terminate tls
+		{"gateway", INGRESS_GATEWAY, TLS_CERT_MANAGER, true, []string{"HTTPRoute/net-ingress"}, false, false},
+		{"unknown", "haproxy", TLS_CERT_MANAGER, false, nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k8sConfig := version1.K8sConfig{
+				K8sPrefix:     "net",
+				Namespace:     "net",
+				Domain:        "example.com",
+				Labels:        map[string]string{NETWORK_LABEL: "net"},
+				TLSSecretName: "wildcard-tls",
+				Ingress:       version1.K8sIngress{Provider: tt.provider, GatewayName: "gateway"},
+				TLS:           version1.K8sTLS{Mode: tt.tlsMode, Issuer: "letsencrypt"},
+				Exposure:      version1.K8sExposure{NodeRoutes: tt.nodeRoutes},
+			}
+
+			objs, err := buildIngresses(k8sConfig, 2, 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			got := []string{}
+			for _, obj := range objs {
+				u, err := toUnstructured(obj)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, u.GetKind()+"/"+u.GetName())
+
+				if u.GetNamespace() != "net" || u.GetLabels()[NETWORK_LABEL] != "net" {
+					t.Fatalf("%s/%s is not in the namespace of the network or not labeled", u.GetKind(), u.GetName())
+				}
+				switch u.GetKind() {
+				case "Ingress", "IngressRoute", "HTTPRoute":
+					if host := ingressHost(*u); host != "net.example.com" {
+						t.Fatalf("expected host net.example.com for %s/%s, got '%s'", u.GetKind(), u.GetName(), host)
+					}
+					if _, hasTLS, _ := unstructured.NestedFieldNoCopy(u.Object, "spec", "tls"); hasTLS != tt.wantTLS {
+						t.Fatalf("expected tls %v for %s/%s", tt.wantTLS, u.GetKind(), u.GetName())
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
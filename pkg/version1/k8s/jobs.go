@@ -0,0 +1,172 @@
+/*
+ * jobs.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const BOOTSTRAP_JOB_TTL = int32(3600)
+
+func buildBootstrapJob(k8sConfig version1.K8sConfig, image string, args []string) batchv1.Job {
+
+	labels := map[string]string{}
+	for k, v := range k8sConfig.Labels {
+		labels[k] = v
+	}
+	labels["type"] = "bootstrap"
+
+	backoffLimit := int32(0)
+	ttl := BOOTSTRAP_JOB_TTL
+
+	return batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: k8sConfig.PrefixWith("bootstrap-"),
+			Namespace:    k8sConfig.Namespace,
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					ImagePullSecrets: []corev1.LocalObjectReference{
+						{
+							Name: k8sConfig.PullSecretName,
+						},
+					},
+					ServiceAccountName: bootstrapServiceAccountName(k8sConfig),
+					Containers: []corev1.Container{
+						{
+							Name:    "camktncr",
+							Image:   image,
+							Command: []string{"camktncr"},
+							Args:    args,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// RunBootstrapJob starts a job running camktncr with args inside the network namespace,
+// streams its logs to out and returns once the job has finished
+func RunBootstrapJob(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, image string, args []string, out io.Writer) error {
+
+	job := buildBootstrapJob(k8sConfig, image, args)
+
+	// every run is a new job with a generated name, so it is created instead of applied
+	jobClient := clientset.BatchV1().Jobs(k8sConfig.Namespace)
+	createdJob, err := jobClient.Create(ctx, &job, metav1.CreateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	if err != nil {
+		return err
+	}
+
+	podName, err := waitForJobPod(ctx, clientset, createdJob)
+	if err != nil {
+		return err
+	}
+
+	logs, err := clientset.CoreV1().Pods(k8sConfig.Namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Follow: true,
+	}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	_, err = io.Copy(out, logs)
+	if err != nil {
+		return err
+	}
+
+	for {
+		current, err := jobClient.Get(ctx, createdJob.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if finished, err := jobFinished(current); finished {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not wait for bootstrap job %s: %v", current.Name, ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
+
+// jobFinished reports whether the job has completed or failed, the error is set if it failed
+func jobFinished(job *batchv1.Job) (bool, error) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return true, fmt.Errorf("bootstrap job %s failed: %s", job.Name, condition.Message)
+		}
+	}
+	return false, nil
+}
+
+// waitForJobPod waits until the pod of the job has started (or already terminated) so its logs can be read,
+// it fails if the job failed or the pod is stuck (e.g. on a wrong image)
+func waitForJobPod(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) (string, error) {
+	for {
+		current, err := clientset.BatchV1().Jobs(job.Namespace).Get(ctx, job.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		pods, err := clientset.CoreV1().Pods(job.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("job-name=%s", job.Name),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != corev1.PodPending {
+				return pod.Name, nil
+			}
+			if problem := podProblem(pod, time.Now()); problem != "" {
+				return "", &PodError{Pod: pod.Name, Reason: problem}
+			}
+		}
+
+		// without a pod the job can only fail on its own (e.g. a missing service account)
+		if _, err := jobFinished(current); err != nil {
+			return "", err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("could not wait for bootstrap job %s to start: %v", job.Name, ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * join.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	JOIN_CONFIG_FILE = "join.json"
+	STAKER_CERT_FILE = "staker.crt"
+	STAKER_KEY_FILE  = "staker.key"
+	NODE_ID_FILE     = "node-id"
+)
+
+// JoinConfig is everything a node outside of the cluster needs to join a network
+type JoinConfig struct {
+	Network      string   `json:"network"`
+	NetworkID    uint32   `json:"networkID"`
+	BootstrapIDs []string `json:"bootstrapIDs"`
+	BootstrapIPs []string `json:"bootstrapIPs"`
+}
+
+// Flags are the camino-node flags of the join config, genesisFile is where the node finds the genesis
+func (c JoinConfig) Flags(genesisFile string) []string {
+	return []string{
+		fmt.Sprintf("--network-id=%d", c.NetworkID),
+		fmt.Sprintf("--genesis=%s", genesisFile),
+		fmt.Sprintf("--bootstrap-ids=%s", strings.Join(c.BootstrapIDs, ",")),
+		fmt.Sprintf("--bootstrap-ips=%s", strings.Join(c.BootstrapIPs, ",")),
+	}
+}
+
+// BuildJoinConfig collects the validators whose staking port is exposed (see --expose-staking) as bootstrap nodes
+func BuildJoinConfig(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (*JoinConfig, error) {
+	raw, err := LiveGenesis(ctx, clientset, k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+	genesisConfig, err := ParseGenesis(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	joinConfig := &JoinConfig{
+		Network:   k8sConfig.K8sPrefix,
+		NetworkID: genesisConfig.NetworkID,
+	}
+
+	selector := metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: k8sConfig.Labels}) + "," + NODE_LABEL
+	services, err := clientset.CoreV1().Services(k8sConfig.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(services.Items, func(i, j int) bool {
+		return services.Items[i].Name < services.Items[j].Name
+	})
+
+	for _, service := range services.Items {
+		node := service.Labels[NODE_LABEL]
+		if service.Name != StakingServiceName(k8sConfig, node) {
+			continue
+		}
+		logger := zap.L().With(zap.String("service", service.Name))
+
+		ip, err := stakingAddress(ctx, clientset, k8sConfig, service)
+		if err != nil {
+			return nil, err
+		}
+		if ip == "" {
+			logger.Warn("staking service has no public address yet, skipping it")
+			continue
+		}
+
+		nodeID, err := nodeIDOf(ctx, clientset, k8sConfig, node)
+		if err != nil {
+			return nil, err
+		}
+
+		joinConfig.BootstrapIDs = append(joinConfig.BootstrapIDs, nodeID)
+		joinConfig.BootstrapIPs = append(joinConfig.BootstrapIPs, ip)
+	}
+
+	if len(joinConfig.BootstrapIPs) == 0 {
+		return nil, fmt.Errorf("network %s has no reachable staking services, create it with --expose-staking", k8sConfig.K8sPrefix)
+	}
+	return joinConfig, nil
+}
+
+// stakingAddress returns the public <ip>:<port> of a staking service, empty if it has none (yet)
+func stakingAddress(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, service corev1.Service) (string, error) {
+	if len(service.Spec.Ports) == 0 {
+		return "", nil
+	}
+
+	switch service.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return net.JoinHostPort(ingress.IP, strconv.Itoa(NODE_STAKING_PORT)), nil
+			}
+			// the bootstrap ips of a node cannot be host names
+			if ingress.Hostname != "" {
+				addrs, err := net.DefaultResolver.LookupHost(ctx, ingress.Hostname)
+				if err != nil {
+					return "", fmt.Errorf("could not resolve the load balancer of %s: %w", service.Name, err)
+				}
+				return net.JoinHostPort(addrs[0], strconv.Itoa(NODE_STAKING_PORT)), nil
+			}
+		}
+		return "", nil
+	case corev1.ServiceTypeNodePort:
+		// the external traffic policy is local, only the node running the pod accepts the traffic
+		pod, err := clientset.CoreV1().Pods(k8sConfig.Namespace).Get(ctx, service.Spec.Selector[podNameLabel], metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		if pod.Spec.NodeName == "" {
+			return "", nil
+		}
+		node, err := clientset.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == corev1.NodeExternalIP {
+				return net.JoinHostPort(addr.Address, strconv.Itoa(int(service.Spec.Ports[0].NodePort))), nil
+			}
+		}
+		return "", nil
+	default:
+		return "", nil
+	}
+}
+
+// nodeIDOf reads the node id of a validator (e.g. validator-0) from its staker secret
+func nodeIDOf(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, node string) (string, error) {
+	index, err := stakerIndex(node)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%d", k8sConfig.K8sPrefix, index)
+	secret, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Data[NODE_ID_KEY]), nil
+}
+
+// stakerIndex maps a validator to the index of its staker, the root node runs the first one
+func stakerIndex(node string) (int, error) {
+	role, ordinal, ok := strings.Cut(node, "-")
+	index, err := strconv.Atoi(ordinal)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid node name '%s'", node)
+	}
+	switch role {
+	case "root":
+		return index, nil
+	case "validator":
+		return index + 1, nil
+	default:
+		return 0, fmt.Errorf("node %s is not a validator", node)
+	}
+}
+
+// NumRunningValidators is the number of stakers the root node and the validators run, including paused ones
+func NumRunningValidators(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (int, error) {
+	count := 0
+	for _, nodeType := range []string{"root", "validator"} {
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: nodeType}
+		sts, err := clientset.AppsV1().StatefulSets(k8sConfig.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+		if err != nil {
+			return 0, err
+		}
+
+		if paused, ok := sts.Annotations[PAUSED_REPLICAS_ANNOTATION]; ok {
+			replicas, err := strconv.Atoi(paused)
+			if err != nil {
+				return 0, err
+			}
+			count += replicas
+		} else if sts.Spec.Replicas != nil {
+			count += int(*sts.Spec.Replicas)
+		} else {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -13,50 +13,71 @@ import (
 	"fmt"
 	"io/fs"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"chain4travel.com/camktncr/pkg/version1"
 	"github.com/ava-labs/avalanchego/genesis"
-	promVersioned "github.com/prometheus-operator/prometheus-operator/pkg/client/versioned"
+	"github.com/ava-labs/avalanchego/ids"
 	corev1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	applyv1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-
-	applymetav1 "k8s.io/client-go/applyconfigurations/meta/v1"
 )
 
 const FIELD_MANAGER_STRING = "camktncr-test-net-creator"
 const DEFAULT_TIMEOUT = 2 * time.Second
 
-func CreateNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
-	namespace := corev1.Namespace{
+// buildNamespace marks the namespace as owned by the network, destroy refuses to touch namespaces without this mark
+func buildNamespace(k8sConfig version1.K8sConfig, ownership Ownership) *corev1.Namespace {
+	labels := map[string]string{
+		MANAGED_BY_LABEL: MANAGED_BY_VALUE,
+	}
+	for k, v := range k8sConfig.Labels {
+		labels[k] = v
+	}
+
+	annotations := ownership.Annotations()
+	// commands that only know the network name need the scheme of the public url
+	annotations[TLS_MODE_ANNOTATION] = k8sConfig.TLS.Mode
+
+	return &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: k8sConfig.Namespace,
+			Name:        k8sConfig.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 	}
+}
 
-	_, err := clientset.CoreV1().Namespaces().Create(ctx, &namespace, metav1.CreateOptions{})
-	if err != nil && !k8sErrors.IsAlreadyExists(err) {
-		return err
+// EnsureNamespace creates the namespace of the network if it does not exist yet, so the lock can be taken in it.
+// An existing namespace is left as it is, CreateNamespace updates it under the lock.
+func EnsureNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, ownership Ownership) error {
+	_, err := clientset.CoreV1().Namespaces().Create(ctx, buildNamespace(k8sConfig, ownership), metav1.CreateOptions{FieldManager: FIELD_MANAGER_STRING})
+	if k8sErrors.IsAlreadyExists(err) {
+		return nil
 	}
-	return nil
+	return err
 }
 
-func CreateNetworkConfigMap(ctx context.Context, clientset *kubernetes.Clientset, genesisConfig genesis.UnparsedConfig, k8sConfig version1.K8sConfig) error {
+// CreateNamespace applies the namespace of the network, the ownership should come from ResolveOwnership
+func CreateNamespace(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, ownership Ownership) error {
+	return applyObjects(ctx, restClient, buildNamespace(k8sConfig, ownership))
+}
+
+func buildNetworkConfigMap(genesisConfig genesis.UnparsedConfig, k8sConfig version1.K8sConfig) (*corev1.ConfigMap, error) {
 
 	genesisJson, err := json.Marshal(genesisConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	configMap := &corev1.ConfigMap{
+	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      k8sConfig.K8sPrefix,
 			Namespace: k8sConfig.Namespace,
@@ -65,489 +86,273 @@ func CreateNetworkConfigMap(ctx context.Context, clientset *kubernetes.Clientset
 		BinaryData: map[string][]byte{
 			"genesis.json": genesisJson,
 		},
-	}
+	}, nil
+}
 
-	_, err = clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, k8sConfig.K8sPrefix, metav1.GetOptions{})
-	if err == nil {
-		err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Delete(ctx, k8sConfig.K8sPrefix, metav1.DeleteOptions{})
-		if err != nil {
-			return err
-		}
+func CreateNetworkConfigMap(ctx context.Context, restClient *rest.Config, genesisConfig genesis.UnparsedConfig, k8sConfig version1.K8sConfig) error {
+	configMap, err := buildNetworkConfigMap(genesisConfig, k8sConfig)
+	if err != nil {
+		return err
 	}
-
-	_, err = clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
-	return err
+	return applyObjects(ctx, restClient, configMap)
 }
 
 //go:embed scripts
 var scriptsFs embed.FS
 
-func CreateScriptsConfigMap(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+func buildScriptsConfigMap(k8sConfig version1.K8sConfig) (*corev1.ConfigMap, error) {
 
 	files, err := fs.Glob(scriptsFs, "scripts/*")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	data := map[string]string{}
-	name := fmt.Sprintf("%s-scripts", k8sConfig.K8sPrefix)
 
 	for _, file := range files {
 
 		stripped := path.Base(file)
 		raw, err := scriptsFs.ReadFile(file)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		data[stripped] = strings.ReplaceAll(string(raw), "\r", "")
 	}
 
-	configMap := &corev1.ConfigMap{
+	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
+			Name:      fmt.Sprintf("%s-scripts", k8sConfig.K8sPrefix),
 			Namespace: k8sConfig.Namespace,
 			Labels:    k8sConfig.Labels,
 		},
 		Data: data,
-	}
+	}, nil
+}
 
-	_, err = clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, name, metav1.GetOptions{})
-	if err == nil {
-		err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
-		if err != nil {
-			return err
-		}
+func CreateScriptsConfigMap(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig) error {
+	configMap, err := buildScriptsConfigMap(k8sConfig)
+	if err != nil {
+		return err
 	}
-
-	_, err = clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
-	return err
+	return applyObjects(ctx, restClient, configMap)
 }
 
-func CreateStakerSecrets(ctx context.Context, clientset *kubernetes.Clientset, stakers []version1.Staker, k8sConfig version1.K8sConfig) error {
-
-	secretType := corev1.SecretTypeTLS
-	kind := "Secret"
-	version := "v1"
-	typeMeta := &applymetav1.TypeMetaApplyConfiguration{
-		Kind:       &kind,
-		APIVersion: &version,
-	}
+func buildStakerSecrets(stakers []version1.Staker, k8sConfig version1.K8sConfig) []runtime.Object {
 
+	secrets := make([]runtime.Object, 0, len(stakers))
 	for i, s := range stakers {
-		name := fmt.Sprintf("%s-%d", k8sConfig.K8sPrefix, i)
-		secret := &applyv1.SecretApplyConfiguration{
-			TypeMetaApplyConfiguration: *typeMeta,
-			ObjectMetaApplyConfiguration: &applymetav1.ObjectMetaApplyConfiguration{
-				Name:      &name,
-				Namespace: &k8sConfig.Namespace,
+		secrets = append(secrets, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%d", k8sConfig.K8sPrefix, i),
+				Namespace: k8sConfig.Namespace,
 				Labels:    k8sConfig.Labels,
 			},
 			Data: map[string][]byte{
-				string(corev1.TLSCertKey):       s.CertBytes,
-				string(corev1.TLSPrivateKeyKey): s.KeyBytes,
+				corev1.TLSCertKey:       s.CertBytes,
+				corev1.TLSPrivateKeyKey: s.KeyBytes,
 			},
 			StringData: map[string]string{
-				"Node-ID":       s.NodeID.String(),
+				NODE_ID_KEY:     s.NodeID.String(),
 				"PublicAddress": s.PublicAddress,
 				"PrivateKey":    s.PrivateKey,
+				"Stake":         strconv.FormatUint(s.Stake, 10),
 			},
+			Type: corev1.SecretTypeTLS,
+		})
+	}
+
+	return secrets
+}
+
+func CreateStakerSecrets(ctx context.Context, restClient *rest.Config, stakers []version1.Staker, k8sConfig version1.K8sConfig) error {
+	return applyObjects(ctx, restClient, buildStakerSecrets(stakers, k8sConfig)...)
+}
 
-			Type: &secretType,
+// LoadStakers reads the stakers with index [from, to) back from the secrets created by CreateStakerSecrets
+func LoadStakers(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, from int, to int) ([]version1.Staker, error) {
+
+	stakers := make([]version1.Staker, 0, to-from)
+	for i := from; i < to; i++ {
+		name := fmt.Sprintf("%s-%d", k8sConfig.K8sPrefix, i)
+		secret, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
 		}
 
-		_, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).Apply(ctx, secret, metav1.ApplyOptions{
-			Force:        true,
-			FieldManager: FIELD_MANAGER_STRING,
-		})
+		nodeID, err := ids.NodeIDFromString(string(secret.Data[NODE_ID_KEY]))
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("secret %s does not contain a valid node id: %w", name, err)
+		}
+
+		// secrets of older networks do not contain the stake
+		stake := version1.BOND_AMOUNT
+		if raw, ok := secret.Data["Stake"]; ok {
+			stake, err = strconv.ParseUint(string(raw), 10, 64)
+			if err != nil {
+				return nil, err
+			}
 		}
+
+		stakers = append(stakers, version1.Staker{
+			NodeID:        nodeID,
+			CertBytes:     secret.Data[corev1.TLSCertKey],
+			KeyBytes:      secret.Data[corev1.TLSPrivateKeyKey],
+			Stake:         stake,
+			PrivateKey:    string(secret.Data["PrivateKey"]),
+			PublicAddress: string(secret.Data["PublicAddress"]),
+		})
 	}
 
-	return nil
+	return stakers, nil
+}
+
+// buildSecretCopy copies the content of secret into the network namespace, the metadata of the source is not carried over
+func buildSecretCopy(secret *corev1.Secret, k8sConfig version1.K8sConfig) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secret.Name,
+			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
+		},
+		Data: secret.Data,
+		Type: secret.Type,
+	}
 }
 
-func CopySecretFromDefaultNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, secretName string) error {
+func CopySecretFromDefaultNamespace(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, secretName string) error {
 
 	secret, err := clientset.CoreV1().Secrets("default").Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
-	secret.Labels = k8sConfig.Labels
-	secret.Namespace = k8sConfig.Namespace
-	secret.ResourceVersion = ""
-	_, err = clientset.CoreV1().Secrets(k8sConfig.Namespace).Create(ctx, secret, metav1.CreateOptions{})
-	if k8sErrors.IsAlreadyExists(err) {
-		return nil
-	}
-	return err
+	return applyObjects(ctx, restClient, buildSecretCopy(secret, k8sConfig))
+}
 
+func bootstrapServiceAccountName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("bootstrap-job")
 }
 
-func CreateRBAC(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+// buildRBAC lets the bootstrap job read the staker secrets it registers, the nodes get them projected and need no access
+func buildRBAC(k8sConfig version1.K8sConfig) []runtime.Object {
 
-	saName := k8sConfig.PrefixWith("init-container")
+	name := bootstrapServiceAccountName(k8sConfig)
 
-	sa := corev1.ServiceAccount{
+	sa := &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      saName,
+			Name:      name,
 			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
 		},
 	}
 
-	saClient := clientset.CoreV1().ServiceAccounts(k8sConfig.Namespace)
-
-	_, foundErr := saClient.Get(ctx, saName, metav1.GetOptions{})
-	if foundErr == nil {
-		_, err := saClient.Update(ctx, &sa, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		_, err := saClient.Create(ctx, &sa, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	roleName := k8sConfig.PrefixWith("secret-reader")
-	role := rbacv1.Role{
+	role := &rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      roleName,
+			Name:      name,
 			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
 		},
 		Rules: []rbacv1.PolicyRule{
 			{
 				APIGroups: []string{""},
 				Resources: []string{"secrets"},
-				Verbs:     []string{"get", "watch", "list"},
+				Verbs:     []string{"get"},
 			},
 		},
 	}
 
-	roleClient := clientset.RbacV1().Roles(k8sConfig.Namespace)
-
-	_, foundErr = roleClient.Get(ctx, roleName, metav1.GetOptions{})
-	if foundErr == nil {
-		_, err := roleClient.Update(ctx, &role, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-
-		_, err := roleClient.Create(ctx, &role, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	rbName := k8sConfig.PrefixWith("read-pods")
-	rb := rbacv1.RoleBinding{
+	rb := &rbacv1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      rbName,
+			Name:      name,
 			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
 		},
 		Subjects: []rbacv1.Subject{
 			{
 				Kind: "ServiceAccount",
-				Name: saName,
+				Name: name,
 			},
 		},
 
 		RoleRef: rbacv1.RoleRef{
 			Kind:     "Role",
 			APIGroup: "rbac.authorization.k8s.io",
-			Name:     roleName,
+			Name:     name,
 		},
 	}
 
-	rbClient := clientset.RbacV1().RoleBindings(k8sConfig.Namespace)
-
-	_, foundErr = rbClient.Get(ctx, rbName, metav1.GetOptions{})
-	if foundErr == nil {
-		_, err := rbClient.Update(ctx, &rb, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-
-		_, err := rbClient.Create(ctx, &rb, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-
+	return []runtime.Object{sa, role, rb}
 }
 
-func CreateApiNodes(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, numberOfNodes int32) error {
+func CreateRBAC(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig) error {
+	return applyObjects(ctx, restClient, buildRBAC(k8sConfig)...)
+}
 
-	options := stateFullSetOptions{
+func apiNodesOptions(k8sConfig version1.K8sConfig, numberOfNodes int32) stateFullSetOptions {
+	return stateFullSetOptions{
 		K8sConfig:   k8sConfig,
 		Type:        "api",
 		IsValidator: false,
 		IsRoot:      false,
 		Replicas:    numberOfNodes,
 		Requests:    k8sConfig.Resources.Api,
+		Limits:      k8sConfig.Resources.ApiLimits,
+		Probe:       k8sConfig.Probes.Api,
+		Storage:     k8sConfig.Resources.Storage.Api,
+		Scheduling:  k8sConfig.Scheduling.Api,
 	}
-
-	return createStatefulSetWithOptions(ctx, restClient, clientset, options)
 }
 
-func CreateRootNode(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
-
-	options := stateFullSetOptions{
+func rootNodeOptions(k8sConfig version1.K8sConfig) stateFullSetOptions {
+	return stateFullSetOptions{
 		K8sConfig:   k8sConfig,
 		Type:        "root",
 		IsValidator: true,
 		IsRoot:      true,
 		Replicas:    1,
 		Requests:    k8sConfig.Resources.Validator,
+		Limits:      k8sConfig.Resources.ValidatorLimits,
+		Probe:       k8sConfig.Probes.Root,
+		Storage:     k8sConfig.Resources.Storage.Root,
+		Scheduling:  k8sConfig.Scheduling.Root,
 	}
-
-	return createStatefulSetWithOptions(ctx, restClient, clientset, options)
 }
 
-func CreateValidators(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, numberOfNodes int32) error {
-
-	options := stateFullSetOptions{
+func validatorsOptions(k8sConfig version1.K8sConfig, numberOfNodes int32) stateFullSetOptions {
+	return stateFullSetOptions{
 		K8sConfig:   k8sConfig,
 		Type:        "validator",
 		IsValidator: true,
 		IsRoot:      false,
 		Replicas:    numberOfNodes,
 		Requests:    k8sConfig.Resources.Validator,
+		Limits:      k8sConfig.Resources.ValidatorLimits,
+		Probe:       k8sConfig.Probes.Validator,
+		Storage:     k8sConfig.Resources.Storage.Validator,
+		Scheduling:  k8sConfig.Scheduling.Validator,
 	}
-
-	return createStatefulSetWithOptions(ctx, restClient, clientset, options)
 }
 
-func CreateIngress(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, annotations map[string]string) error {
-	pathType := networkingv1.PathTypePrefix
-	static_annotations := make(map[string]string)
-	for k, v := range annotations {
-		static_annotations[k] = v
-	}
-	static_annotations["nginx.ingress.kubernetes.io/rewrite-target"] = "/$2"
-
-	nginx := "nginx"
-	ingress := networkingv1.Ingress{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        k8sConfig.PrefixWith("ingress"),
-			Namespace:   k8sConfig.Namespace,
-			Annotations: annotations,
-			Labels:      k8sConfig.Labels,
-		},
-		Spec: networkingv1.IngressSpec{
-			IngressClassName: &nginx,
-			Rules: []networkingv1.IngressRule{
-				{
-					Host: fmt.Sprintf("%s.%s", k8sConfig.Namespace, k8sConfig.Domain),
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{
-								{
-									Path:     "/",
-									PathType: &pathType,
-									Backend: networkingv1.IngressBackend{
-										Service: &networkingv1.IngressServiceBackend{
-											Name: k8sConfig.PrefixWith("api"),
-											Port: networkingv1.ServiceBackendPort{
-												Name: "rpc",
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			TLS: []networkingv1.IngressTLS{
-				{
-					Hosts: []string{
-						k8sConfig.Namespace + "." + k8sConfig.Domain,
-					},
-					SecretName: k8sConfig.PrefixWith("tls-secret"),
-				},
-			},
-		},
-	}
-
-	static_ingress := networkingv1.Ingress{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        k8sConfig.PrefixWith("ingress-static"),
-			Namespace:   k8sConfig.Namespace,
-			Annotations: static_annotations,
-			Labels:      k8sConfig.Labels,
-		},
-		Spec: networkingv1.IngressSpec{
-			IngressClassName: &nginx,
-			Rules: []networkingv1.IngressRule{
-				{
-					Host: fmt.Sprintf("%s.%s", k8sConfig.Namespace, k8sConfig.Domain),
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{
-								{
-									Path:     "/static(/|$)(.*)",
-									PathType: &pathType,
-									Backend: networkingv1.IngressBackend{
-										Service: &networkingv1.IngressServiceBackend{
-											Name: k8sConfig.PrefixWith("root"),
-											Port: networkingv1.ServiceBackendPort{
-												Name: "rpc",
-											},
-										},
-									},
-								},
-								// {
-								// 	Path:     "/",
-								// 	PathType: &pathType,
-								// 	Backend: networkingv1.IngressBackend{
-								// 		Service: &networkingv1.IngressServiceBackend{
-								// 			Name: k8sConfig.PrefixWith("api"),
-								// 			Port: networkingv1.ServiceBackendPort{
-								// 				Name: "rpc",
-								// 			},
-								// 		},
-								// 	},
-								// },
-							},
-						},
-					},
-				},
-			},
-			TLS: []networkingv1.IngressTLS{
-				{
-					Hosts: []string{
-						k8sConfig.Namespace + "." + k8sConfig.Domain,
-					},
-					SecretName: k8sConfig.PrefixWith("tls-secret"),
-				},
-			},
-		},
-	}
-
-	ingClient := clientset.NetworkingV1().Ingresses(k8sConfig.Namespace)
-
-	for _, ing := range []networkingv1.Ingress{static_ingress, ingress} {
-
-		_, foundErr := ingClient.Get(ctx, ing.Name, metav1.GetOptions{})
-		if foundErr == nil {
-			err := ingClient.Delete(ctx, ing.Name, *metav1.NewDeleteOptions(0))
-			if err != nil {
-				return err
-			}
-
-		}
-		_, err := ingClient.Create(ctx, &ing, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
+func CreateApiNodes(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, numberOfNodes int32) error {
+	return createStatefulSetWithOptions(ctx, restClient, clientset, apiNodesOptions(k8sConfig, numberOfNodes))
+}
 
-	}
-	return nil
+func CreateRootNode(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	return createStatefulSetWithOptions(ctx, restClient, clientset, rootNodeOptions(k8sConfig))
+}
 
+func CreateValidators(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, numberOfNodes int32) error {
+	return createStatefulSetWithOptions(ctx, restClient, clientset, validatorsOptions(k8sConfig, numberOfNodes))
 }
 
-func DeleteCluster(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, keepDisks bool) error {
-	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
+func CreateIngress(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, numValidators int32, numApiNodes int32) error {
+	objs, err := buildIngresses(k8sConfig, numValidators, numApiNodes)
 	if err != nil {
 		return err
 	}
-
-	selectorString := selector.String()
-
-	err = clientset.AppsV1().StatefulSets(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-
-	for _, sts := range []string{"api", "root", "validator"} {
-
-		err = clientset.CoreV1().Services(k8sConfig.Namespace).Delete(ctx, k8sConfig.PrefixWith(sts), *metav1.NewDeleteOptions(0))
-		if err != nil && !k8sErrors.IsNotFound(err) {
-			return err
-		}
-	}
-
-	err = clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-	err = clientset.NetworkingV1().Ingresses(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-	err = clientset.CoreV1().Secrets(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-	err = clientset.CoreV1().ServiceAccounts(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-
-	err = clientset.RbacV1().RoleBindings(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-	err = clientset.RbacV1().Roles(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-
-	if !keepDisks {
-
-		err = clientset.CoreV1().PersistentVolumeClaims(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-			LabelSelector: selectorString,
-		})
-		if err != nil && !k8sErrors.IsNotFound(err) {
-			return err
-		}
-	}
-
-	promClientSet, err := promVersioned.NewForConfig(restClient)
+	err = applyObjects(ctx, restClient, objs...)
 	if err != nil {
 		return err
 	}
-
-	err = promClientSet.MonitoringV1().ServiceMonitors(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
-		return err
-	}
-
-	return nil
+	// switching the provider or turning off the node routes leaves objects behind otherwise
+	return pruneIngresses(ctx, restClient, k8sConfig, objs)
 }
@@ -0,0 +1,180 @@
+/*
+ * list.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const NETWORK_LABEL = "network"
+
+const (
+	HEALTH_HEALTHY  = "healthy"
+	HEALTH_DEGRADED = "degraded"
+	HEALTH_EMPTY    = "empty"
+	HEALTH_PAUSED   = "paused"
+)
+
+// NodeCount is the number of ready and desired nodes of a role
+type NodeCount struct {
+	Ready   int32 `json:"ready"`
+	Desired int32 `json:"desired"`
+}
+
+func (c NodeCount) String() string {
+	return fmt.Sprintf("%d/%d", c.Ready, c.Desired)
+}
+
+// NetworkInfo summarizes a network found on the cluster
+type NetworkInfo struct {
+	Name        string     `json:"name"`
+	Namespace   string     `json:"namespace"`
+	Creator     string     `json:"creator,omitempty"`
+	Image       string     `json:"image,omitempty"`
+	Validators  NodeCount  `json:"validators"`
+	ApiNodes    NodeCount  `json:"apiNodes"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	IngressHost string     `json:"ingressHost,omitempty"`
+	Health      string     `json:"health"`
+
+	paused bool
+}
+
+// ListNetworks finds all networks on the cluster by the network label of their namespaces and statefulsets,
+// the latter also finds networks created before namespaces were labeled
+func ListNetworks(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset) ([]NetworkInfo, error) {
+	listOptions := metav1.ListOptions{LabelSelector: NETWORK_LABEL}
+	networks := map[string]*NetworkInfo{}
+
+	networkFor := func(namespace string, name string) *NetworkInfo {
+		key := namespace + "/" + name
+		info, ok := networks[key]
+		if !ok {
+			info = &NetworkInfo{Name: name, Namespace: namespace}
+			networks[key] = info
+		}
+		return info
+	}
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, ns := range namespaces.Items {
+		info := networkFor(ns.Name, ns.Labels[NETWORK_LABEL])
+		info.Creator = ns.Annotations[CREATOR_ANNOTATION]
+		info.CreatedAt = ns.CreationTimestamp.Time
+		if createdAt, err := time.Parse(time.RFC3339, ns.Annotations[CREATED_AT_ANNOTATION]); err == nil {
+			info.CreatedAt = createdAt
+		}
+		// a broken expiry is ignored, such a network is never garbage collected
+		if expiresAt, found, err := parseExpiry(ns.Annotations); err == nil && found {
+			info.ExpiresAt = &expiresAt
+		}
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(metav1.NamespaceAll).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, sts := range statefulSets.Items {
+		info := networkFor(sts.Namespace, sts.Labels[NETWORK_LABEL])
+		addStatefulSet(info, sts)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return nil, err
+	}
+	for _, gvr := range []schema.GroupVersionResource{ingressesResource, ingressRoutesResource, httpRoutesResource} {
+		list, err := dynamicClient.Resource(gvr).Namespace(metav1.NamespaceAll).List(ctx, listOptions)
+		// the crds of the other ingress providers are not installed on every cluster
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			info, ok := networks[item.GetNamespace()+"/"+item.GetLabels()[NETWORK_LABEL]]
+			if ok && info.IngressHost == "" {
+				info.IngressHost = ingressHost(item)
+			}
+		}
+	}
+
+	result := make([]NetworkInfo, 0, len(networks))
+	for _, info := range networks {
+		info.Health = health(*info)
+		result = append(result, *info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result, nil
+}
+
+func addStatefulSet(info *NetworkInfo, sts appsv1.StatefulSet) {
+	desired := int32(1)
+	if sts.Spec.Replicas != nil {
+		desired = *sts.Spec.Replicas
+	}
+
+	count := &info.Validators
+	if sts.Labels["type"] == "api" {
+		count = &info.ApiNodes
+	}
+	count.Desired += desired
+	count.Ready += sts.Status.ReadyReplicas
+
+	if _, paused := sts.Annotations[PAUSED_REPLICAS_ANNOTATION]; paused {
+		info.paused = true
+	}
+
+	if sts.Labels["type"] == "root" || info.Image == "" {
+		for _, c := range sts.Spec.Template.Spec.Containers {
+			if c.Name == "camino-node" {
+				info.Image = c.Image
+			}
+		}
+	}
+
+	// networks without a labeled namespace are as old as their oldest statefulset
+	if info.CreatedAt.IsZero() || sts.CreationTimestamp.Time.Before(info.CreatedAt) {
+		info.CreatedAt = sts.CreationTimestamp.Time
+	}
+}
+
+func health(info NetworkInfo) string {
+	desired := info.Validators.Desired + info.ApiNodes.Desired
+	ready := info.Validators.Ready + info.ApiNodes.Ready
+	switch {
+	case info.paused:
+		return HEALTH_PAUSED
+	case desired == 0:
+		return HEALTH_EMPTY
+	case ready < desired:
+		return HEALTH_DEGRADED
+	default:
+		return HEALTH_HEALTHY
+	}
+}
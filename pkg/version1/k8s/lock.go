@@ -0,0 +1,242 @@
+/*
+ * lock.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"go.uber.org/zap"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const LOCK_LEASE_DURATION = 30 * time.Second
+const LOCK_RENEW_INTERVAL = 10 * time.Second
+
+// LockError is returned if another process holds the lock of the network
+type LockError struct {
+	Network string
+	Holder  string
+	Since   time.Time
+	Expires time.Time
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("network %s is locked by %s since %s (the lock expires at %s unless it is renewed)",
+		e.Network, e.Holder, e.Since.Format(time.RFC3339), e.Expires.Format(time.RFC3339))
+}
+
+// Lock is a lease in the network namespace held for the duration of a mutating command.
+// The lease is renewed in the background, if it is lost the context of the lock is cancelled.
+type Lock struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	name      string
+	holder    string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func lockName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("lock")
+}
+
+// AcquireLock takes the lock of the network for holder or returns a LockError naming the current holder.
+// The lease is not labeled with the network, so it survives DeleteCluster until it is released.
+func AcquireLock(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, holder string) (*Lock, error) {
+	leaseClient := clientset.CoordinationV1().Leases(k8sConfig.Namespace)
+	name := lockName(k8sConfig)
+	now := metav1.NowMicro()
+	duration := int32(LOCK_LEASE_DURATION / time.Second)
+
+	// leases rely on optimistic concurrency, so they are created and updated instead of applied
+	lease, err := leaseClient.Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: k8sConfig.Namespace,
+				Labels: map[string]string{
+					MANAGED_BY_LABEL: MANAGED_BY_VALUE,
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = leaseClient.Create(ctx, lease, metav1.CreateOptions{FieldManager: FIELD_MANAGER_STRING})
+		if k8sErrors.IsAlreadyExists(err) {
+			return nil, lockErrorFor(ctx, clientset, k8sConfig)
+		}
+	} else if err == nil {
+		if held, lockErr := heldByOther(lease, k8sConfig, holder, time.Now()); held {
+			return nil, lockErr
+		}
+
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.HolderIdentity = &holder
+		lease.Spec.LeaseDurationSeconds = &duration
+		lease.Spec.AcquireTime = &now
+		lease.Spec.RenewTime = &now
+		lease.Spec.LeaseTransitions = &transitions
+
+		_, err = leaseClient.Update(ctx, lease, metav1.UpdateOptions{FieldManager: FIELD_MANAGER_STRING})
+		if k8sErrors.IsConflict(err) {
+			return nil, lockErrorFor(ctx, clientset, k8sConfig)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire the lock of network %s: %w", k8sConfig.K8sPrefix, err)
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	lock := &Lock{
+		clientset: clientset,
+		namespace: k8sConfig.Namespace,
+		name:      name,
+		holder:    holder,
+		ctx:       lockCtx,
+		cancel:    cancel,
+	}
+
+	lock.wg.Add(1)
+	go lock.renew()
+
+	zap.L().Debug("acquired network lock", zap.String("lease", name), zap.String("holder", holder))
+	return lock, nil
+}
+
+// heldByOther returns a LockError if the lease is held by someone else and has not expired at now
+func heldByOther(lease *coordinationv1.Lease, k8sConfig version1.K8sConfig, holder string, now time.Time) (bool, error) {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || *lease.Spec.HolderIdentity == holder {
+		return false, nil
+	}
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false, nil
+	}
+
+	expires := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	if now.After(expires) {
+		return false, nil
+	}
+
+	since := lease.Spec.RenewTime.Time
+	if lease.Spec.AcquireTime != nil {
+		since = lease.Spec.AcquireTime.Time
+	}
+	return true, &LockError{
+		Network: k8sConfig.K8sPrefix,
+		Holder:  *lease.Spec.HolderIdentity,
+		Since:   since,
+		Expires: expires,
+	}
+}
+
+// lockErrorFor is used when another process won the race for the lease
+func lockErrorFor(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	lease, err := clientset.CoordinationV1().Leases(k8sConfig.Namespace).Get(ctx, lockName(k8sConfig), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not acquire the lock of network %s: %w", k8sConfig.K8sPrefix, err)
+	}
+	if held, lockErr := heldByOther(lease, k8sConfig, "", time.Now()); held {
+		return lockErr
+	}
+	return fmt.Errorf("could not acquire the lock of network %s, it was taken concurrently", k8sConfig.K8sPrefix)
+}
+
+func (l *Lock) renew() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(LOCK_RENEW_INTERVAL)
+	defer ticker.Stop()
+
+	leaseClient := l.clientset.CoordinationV1().Leases(l.namespace)
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		lease, err := leaseClient.Get(l.ctx, l.name, metav1.GetOptions{})
+		if err == nil {
+			if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+				zap.L().Error("network lock was taken over, stopping", zap.String("lease", l.name))
+				l.cancel()
+				return
+			}
+			now := metav1.NowMicro()
+			lease.Spec.RenewTime = &now
+			_, err = leaseClient.Update(l.ctx, lease, metav1.UpdateOptions{FieldManager: FIELD_MANAGER_STRING})
+		}
+		if err != nil {
+			if l.ctx.Err() != nil {
+				return
+			}
+			zap.L().Warn("could not renew network lock", zap.String("lease", l.name), zap.Error(err))
+			if time.Since(lastRenewal) > LOCK_LEASE_DURATION {
+				zap.L().Error("network lock expired, stopping", zap.String("lease", l.name))
+				l.cancel()
+				return
+			}
+			continue
+		}
+		lastRenewal = time.Now()
+	}
+}
+
+// Context is cancelled once the lock is lost or released, mutating operations should use it
+func (l *Lock) Context() context.Context {
+	return l.ctx
+}
+
+// Release stops the renewal and deletes the lease if it is still held, it is safe to call on nil
+func (l *Lock) Release() {
+	if l == nil {
+		return
+	}
+	l.cancel()
+	l.wg.Wait()
+
+	// the command context may already be done, releasing should still happen
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_TIMEOUT)
+	defer cancel()
+
+	leaseClient := l.clientset.CoordinationV1().Leases(l.namespace)
+	lease, err := leaseClient.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			zap.L().Warn("could not release network lock", zap.String("lease", l.name), zap.Error(err))
+		}
+		return
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		return
+	}
+
+	err = leaseClient.Delete(ctx, l.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		zap.L().Warn("could not release network lock", zap.String("lease", l.name), zap.Error(err))
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * lock_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHeldByOther(t *testing.T) {
+	now := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	k8sConfig := version1.K8sConfig{K8sPrefix: "net", Namespace: "net"}
+
+	lease := func(holder string, acquired *time.Time, renewed *time.Time, duration *int32) *coordinationv1.Lease {
+		lease := &coordinationv1.Lease{}
+		if holder != "" {
+			lease.Spec.HolderIdentity = &holder
+		}
+		if acquired != nil {
+			acquireTime := metav1.NewMicroTime(*acquired)
+			lease.Spec.AcquireTime = &acquireTime
+		}
+		if renewed != nil {
+			renewTime := metav1.NewMicroTime(*renewed)
+			lease.Spec.RenewTime = &renewTime
+		}
+		lease.Spec.LeaseDurationSeconds = duration
+		return lease
+	}
+	duration := int32(LOCK_LEASE_DURATION / time.Second)
+	acquired := now.Add(-time.Hour)
+	recently := now.Add(-LOCK_LEASE_DURATION / 2)
+	longAgo := now.Add(-2 * LOCK_LEASE_DURATION)
+
+	tests := []struct {
+		name      string
+		lease     *coordinationv1.Lease
+		wantHeld  bool
+		wantSince time.Time
+	}{
+		{"released", lease("", nil, &recently, &duration), false, time.Time{}},
+		{"own lease", lease("me", &acquired, &recently, &duration), false, time.Time{}},
+		{"held by other", lease("other", &acquired, &recently, &duration), true, acquired},
+		{"held without acquire time", lease("other", nil, &recently, &duration), true, recently},
+		{"expired", lease("other", &acquired, &longAgo, &duration), false, time.Time{}},
+		{"never renewed", lease("other", &acquired, nil, &duration), false, time.Time{}},
+		{"no duration", lease("other", &acquired, &recently, nil), false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			held, err := heldByOther(tt.lease, k8sConfig, "me", now)
+			if held != tt.wantHeld {
+				t.Fatalf("expected held %v, got %v", tt.wantHeld, held)
+			}
+			if !held {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var lockErr *LockError
+			if !errors.As(err, &lockErr) {
+				t.Fatalf("expected a LockError, got %v", err)
+			}
+			if lockErr.Holder != "other" || lockErr.Network != "net" || !lockErr.Since.Equal(tt.wantSince) ||
+				!lockErr.Expires.Equal(recently.Add(LOCK_LEASE_DURATION)) {
+				t.Fatalf("unexpected lock error %+v", lockErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ * node_config.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"github.com/ava-labs/avalanchego/genesis"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	NODE_CONFIG_DIR    = "/mnt/node-config"
+	CHAIN_CONFIG_DIR   = "/mnt/chain-config"
+	C_CHAIN_CONFIG_KEY = "c-chain-config.json"
+)
+
+// NODE_CONFIG_HASH_ANNOTATION on the pod template rolls the pods of a role when its config changes
+const NODE_CONFIG_HASH_ANNOTATION = ANNOTATION_PREFIX + "node-config-hash"
+
+func nodeConfigMapName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("node-config")
+}
+
+// nodeConfigFile is where the config.json of a role is mounted
+func nodeConfigFile(role string) string {
+	return fmt.Sprintf("%s/%s.json", NODE_CONFIG_DIR, role)
+}
+
+// buildNodeConfig returns the camino-node flags of a role, the overrides of the role replace the defaults.
+// The public ip and the bootstrap nodes are only known in the pod, start.sh passes them as flags.
+func buildNodeConfig(k8sConfig version1.K8sConfig, role string, networkID uint32) map[string]interface{} {
+	config := map[string]interface{}{
+		"network-id":           fmt.Sprint(networkID),
+		"genesis":              "/mnt/conf/genesis.json",
+		"db-dir":               "/mnt/data",
+		"http-host":            "0.0.0.0",
+		"http-port":            NODE_API_PORT,
+		"http-allowed-origins": "*",
+		"api-admin-enabled":    true,
+		"log-level":            "debug",
+	}
+
+	if role == "api" {
+		config["index-enabled"] = true
+	} else {
+		// the certificate depends on the ordinal of the pod, start.sh passes it
+		config["staking-port"] = NODE_STAKING_PORT
+	}
+
+	if len(k8sConfig.NodeConfig.CChain) > 0 {
+		config["chain-config-dir"] = CHAIN_CONFIG_DIR
+	}
+
+	for k, v := range k8sConfig.NodeConfig.ForRole(role) {
+		config[k] = v
+	}
+	return config
+}
+
+// buildNodeConfigMap renders the config.json of every role (<role>.json) and the optional C-chain config
+func buildNodeConfigMap(k8sConfig version1.K8sConfig, genesisConfig genesis.UnparsedConfig) (*corev1.ConfigMap, error) {
+	data := map[string]string{}
+	for _, role := range NODE_TYPES {
+		raw, err := json.MarshalIndent(buildNodeConfig(k8sConfig, role, genesisConfig.NetworkID), "", "\t")
+		if err != nil {
+			return nil, err
+		}
+		data[role+".json"] = string(raw)
+	}
+	if len(k8sConfig.NodeConfig.CChain) > 0 {
+		data[C_CHAIN_CONFIG_KEY] = string(k8sConfig.NodeConfig.CChain)
+	}
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nodeConfigMapName(k8sConfig),
+			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
+		},
+		Data: data,
+	}, nil
+}
+
+// nodeConfigHash identifies the config.json of a role together with the C-chain config.
+// The network id is left out, it comes from the genesis which is never changed in place.
+func nodeConfigHash(k8sConfig version1.K8sConfig, role string) string {
+	config := buildNodeConfig(k8sConfig, role, 0)
+	delete(config, "network-id")
+
+	hash := sha256.New()
+	// the values are strings or were parsed from json, they always marshal
+	raw, _ := json.Marshal(config)
+	hash.Write(raw)
+	hash.Write(k8sConfig.NodeConfig.CChain)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CreateNodeConfigMap applies the node configs, the pods of a role restart when its config changes
+func CreateNodeConfigMap(ctx context.Context, restClient *rest.Config, genesisConfig genesis.UnparsedConfig, k8sConfig version1.K8sConfig) error {
+	configMap, err := buildNodeConfigMap(k8sConfig, genesisConfig)
+	if err != nil {
+		return err
+	}
+	return applyObjects(ctx, restClient, configMap)
+}
+
+// nodeConfigVolumes mounts the config.json of the role and, if there is one, the C-chain config
+// as <chain-config-dir>/C/config.json
+func nodeConfigVolumes(k8sConfig version1.K8sConfig) ([]corev1.Volume, []corev1.VolumeMount) {
+	defaultMode := int32(0444)
+
+	volumes := []corev1.Volume{
+		{Name: "node-config-vol", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: nodeConfigMapName(k8sConfig),
+				},
+				DefaultMode: &defaultMode,
+			},
+		}},
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "node-config-vol", MountPath: NODE_CONFIG_DIR, ReadOnly: true},
+	}
+
+	if len(k8sConfig.NodeConfig.CChain) > 0 {
+		volumes = append(volumes, corev1.Volume{Name: "chain-config-vol", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: nodeConfigMapName(k8sConfig),
+				},
+				Items: []corev1.KeyToPath{
+					{Key: C_CHAIN_CONFIG_KEY, Path: "C/config.json"},
+				},
+				DefaultMode: &defaultMode,
+			},
+		}})
+		mounts = append(mounts, corev1.VolumeMount{Name: "chain-config-vol", MountPath: CHAIN_CONFIG_DIR, ReadOnly: true})
+	}
+
+	return volumes, mounts
+}
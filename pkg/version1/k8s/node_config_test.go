@@ -0,0 +1,58 @@
+/*
+ * node_config_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"testing"
+
+	"chain4travel.com/camktncr/pkg/version1"
+)
+
+func TestNodeConfigHash(t *testing.T) {
+	base := func() version1.K8sConfig {
+		return version1.K8sConfig{
+			K8sPrefix: "net",
+			Namespace: "net",
+			NodeConfig: version1.K8sNodeConfigs{
+				Root:      map[string]interface{}{"log-level": "info"},
+				Validator: map[string]interface{}{"log-level": "info", "snow-sample-size": float64(5)},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		change      func(k *version1.K8sConfig)
+		role        string
+		wantChanged bool
+	}{
+		{"unchanged", func(k *version1.K8sConfig) {}, "validator", false},
+		{"unrelated fields", func(k *version1.K8sConfig) { k.Image = "camino-node:new"; k.BootstrapNodes = 3 }, "validator", false},
+		{"same values rebuilt", func(k *version1.K8sConfig) {
+			k.NodeConfig.Validator = map[string]interface{}{"snow-sample-size": float64(5), "log-level": "info"}
+		}, "validator", false},
+		{"own override", func(k *version1.K8sConfig) { k.NodeConfig.Validator["log-level"] = "debug" }, "validator", true},
+		{"new override", func(k *version1.K8sConfig) { k.NodeConfig.Validator["index-enabled"] = true }, "validator", true},
+		{"override of another role", func(k *version1.K8sConfig) { k.NodeConfig.Root["log-level"] = "debug" }, "validator", false},
+		{"c-chain config on api", func(k *version1.K8sConfig) { k.NodeConfig.CChain = []byte(`{"pruning-enabled":false}`) }, "api", true},
+		{"c-chain config on root", func(k *version1.K8sConfig) { k.NodeConfig.CChain = []byte(`{"pruning-enabled":false}`) }, "root", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := nodeConfigHash(base(), tt.role)
+
+			changed := base()
+			tt.change(&changed)
+			after := nodeConfigHash(changed, tt.role)
+
+			if (before != after) != tt.wantChanged {
+				t.Fatalf("expected changed %v, hash went from %s to %s", tt.wantChanged, before, after)
+			}
+		})
+	}
+}
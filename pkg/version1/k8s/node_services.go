@@ -0,0 +1,143 @@
+/*
+ * node_services.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const NODE_STAKING_PORT = 9651
+
+// NODE_LABEL marks the services of a single node with its name without the network prefix, e.g. validator-0
+const NODE_LABEL = "node"
+
+const (
+	EXPOSE_STAKING_NONE          = "none"
+	EXPOSE_STAKING_LOAD_BALANCER = "loadbalancer"
+	EXPOSE_STAKING_NODE_PORT     = "nodeport"
+)
+
+var EXPOSE_STAKING_MODES = []string{EXPOSE_STAKING_NONE, EXPOSE_STAKING_LOAD_BALANCER, EXPOSE_STAKING_NODE_PORT}
+
+func ParseStakingExposure(mode string) (string, error) {
+	return parseEnum("staking exposure", mode, EXPOSE_STAKING_MODES)
+}
+
+// podNameLabel is set on every pod by the statefulset controller
+const podNameLabel = "statefulset.kubernetes.io/pod-name"
+
+// NodeNames returns the names of all nodes without the network prefix, root first
+func NodeNames(numValidators int32, numApiNodes int32) []string {
+	nodes := []string{"root-0"}
+	for i := int32(0); i < numValidators-1; i++ {
+		nodes = append(nodes, fmt.Sprintf("validator-%d", i))
+	}
+	for i := int32(0); i < numApiNodes; i++ {
+		nodes = append(nodes, fmt.Sprintf("api-%d", i))
+	}
+	return nodes
+}
+
+// StakingServiceName is the service exposing the staking port of a validator outside the cluster
+func StakingServiceName(k8sConfig version1.K8sConfig, node string) string {
+	return k8sConfig.PrefixWith(node + "-staking")
+}
+
+// buildNodeServices returns a service per pod for the per node routes
+// and, if the staking port is exposed, one of type LoadBalancer or NodePort per validator
+func buildNodeServices(options stateFullSetOptions) []runtime.Object {
+	exposure := options.Exposure
+	objs := []runtime.Object{}
+
+	for i := int32(0); i < options.Replicas; i++ {
+		node := fmt.Sprintf("%s-%d", options.Type, i)
+		labels := options.Labels()
+		labels[NODE_LABEL] = node
+		selector := map[string]string{podNameLabel: options.PrefixWith(node)}
+
+		if exposure.NodeRoutes {
+			objs = append(objs, &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      options.PrefixWith(node),
+					Namespace: options.Namespace,
+					Labels:    labels,
+				},
+				Spec: corev1.ServiceSpec{
+					Type: corev1.ServiceTypeClusterIP,
+					Ports: []corev1.ServicePort{
+						{Name: "rpc", Port: NODE_API_PORT, TargetPort: intstr.FromInt(NODE_API_PORT)},
+					},
+					Selector: selector,
+				},
+			})
+		}
+
+		if !options.IsValidator || exposure.Staking == "" || exposure.Staking == EXPOSE_STAKING_NONE {
+			continue
+		}
+		serviceType := corev1.ServiceTypeLoadBalancer
+		if exposure.Staking == EXPOSE_STAKING_NODE_PORT {
+			serviceType = corev1.ServiceTypeNodePort
+		}
+		objs = append(objs, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        StakingServiceName(options.K8sConfig, node),
+				Namespace:   options.Namespace,
+				Labels:      labels,
+				Annotations: exposure.StakingAnnotations,
+			},
+			Spec: corev1.ServiceSpec{
+				Type: serviceType,
+				Ports: []corev1.ServicePort{
+					{Name: "staking", Port: NODE_STAKING_PORT, TargetPort: intstr.FromInt(NODE_STAKING_PORT)},
+				},
+				Selector: selector,
+				// keeps the source ip of the peers, the node sees who connects
+				ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeLocal,
+			},
+		})
+	}
+	return objs
+}
+
+// applyNodeServices applies the services of the nodes of a role and deletes those of nodes that no longer exist
+// or whose exposure was turned off
+func applyNodeServices(ctx context.Context, dynamicClient dynamic.Interface, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	desired := map[string]bool{}
+	for _, obj := range buildNodeServices(options) {
+		applied, err := applyObject(ctx, dynamicClient, obj, false)
+		if err != nil {
+			return err
+		}
+		desired[applied.GetName()] = true
+	}
+
+	selector := metav1.FormatLabelSelector(options.Selector()) + "," + NODE_LABEL
+	services, err := clientset.CoreV1().Services(options.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+	for _, service := range services.Items {
+		if desired[service.Name] {
+			continue
+		}
+		err = clientset.CoreV1().Services(options.Namespace).Delete(ctx, service.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
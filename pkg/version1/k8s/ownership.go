@@ -0,0 +1,115 @@
+/*
+ * ownership.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const ANNOTATION_PREFIX = "camktncr.chain4travel.com/"
+
+const (
+	CREATOR_ANNOTATION      = ANNOTATION_PREFIX + "creator"
+	VERSION_ANNOTATION      = ANNOTATION_PREFIX + "version"
+	NETWORK_HASH_ANNOTATION = ANNOTATION_PREFIX + "network-hash"
+	CREATED_AT_ANNOTATION   = ANNOTATION_PREFIX + "created-at"
+)
+
+// Ownership is recorded on the namespace of a network so it is clear who created it from which network file
+type Ownership struct {
+	Creator     string
+	Version     string
+	NetworkHash string
+	CreatedAt   time.Time
+}
+
+func (o Ownership) Annotations() map[string]string {
+	return map[string]string{
+		CREATOR_ANNOTATION:      o.Creator,
+		VERSION_ANNOTATION:      o.Version,
+		NETWORK_HASH_ANNOTATION: o.NetworkHash,
+		CREATED_AT_ANNOTATION:   o.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// OwnershipError is returned if a namespace was not created by camktncr for the network
+type OwnershipError struct {
+	Namespace string
+	Reason    string
+}
+
+func (e *OwnershipError) Error() string {
+	return fmt.Sprintf("namespace %s is not owned by this network: %s", e.Namespace, e.Reason)
+}
+
+// checkNamespaceLabels verifies that the namespace carries the labels create puts on it
+func checkNamespaceLabels(namespace *corev1.Namespace, k8sConfig version1.K8sConfig) error {
+	if namespace.Labels[MANAGED_BY_LABEL] != MANAGED_BY_VALUE {
+		return &OwnershipError{Namespace: namespace.Name, Reason: fmt.Sprintf("label %s=%s is missing", MANAGED_BY_LABEL, MANAGED_BY_VALUE)}
+	}
+	for k, v := range k8sConfig.Labels {
+		if namespace.Labels[k] != v {
+			return &OwnershipError{Namespace: namespace.Name, Reason: fmt.Sprintf("label %s is '%s' instead of '%s'", k, namespace.Labels[k], v)}
+		}
+	}
+	return nil
+}
+
+// CheckOwnership verifies that the namespace was created by camktncr for the network
+func CheckOwnership(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return checkNamespaceLabels(namespace, k8sConfig)
+}
+
+// ResolveOwnership returns the ownership to record on the namespace of the network.
+// A namespace created from the same network file keeps its creator and creation time,
+// any other existing namespace is refused unless force is set.
+func ResolveOwnership(ctx context.Context, clientset kubernetes.Interface, k8sConfig version1.K8sConfig, requested Ownership, force bool) (Ownership, error) {
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return requested, nil
+	}
+	if err != nil {
+		return requested, err
+	}
+
+	err = checkNamespaceLabels(namespace, k8sConfig)
+	if err == nil {
+		hash := namespace.Annotations[NETWORK_HASH_ANNOTATION]
+		if hash != "" && hash != requested.NetworkHash {
+			err = &OwnershipError{
+				Namespace: namespace.Name,
+				Reason:    fmt.Sprintf("it was created by %s from a different network file", namespace.Annotations[CREATOR_ANNOTATION]),
+			}
+		}
+	}
+	if err != nil {
+		if force {
+			return requested, nil
+		}
+		return requested, err
+	}
+
+	if creator, ok := namespace.Annotations[CREATOR_ANNOTATION]; ok {
+		requested.Creator = creator
+	}
+	if createdAt, parseErr := time.Parse(time.RFC3339, namespace.Annotations[CREATED_AT_ANNOTATION]); parseErr == nil {
+		requested.CreatedAt = createdAt
+	}
+	return requested, nil
+}
@@ -0,0 +1,127 @@
+/*
+ * ownership_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func ownershipConfig() version1.K8sConfig {
+	return version1.K8sConfig{
+		K8sPrefix: "net",
+		Namespace: "net",
+		Labels:    map[string]string{NETWORK_LABEL: "net"},
+	}
+}
+
+func ownedNamespace(labels map[string]string, annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "net",
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+}
+
+func TestCheckNamespaceLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"owned", map[string]string{MANAGED_BY_LABEL: MANAGED_BY_VALUE, NETWORK_LABEL: "net"}, false},
+		{"extra labels", map[string]string{MANAGED_BY_LABEL: MANAGED_BY_VALUE, NETWORK_LABEL: "net", "team": "qa"}, false},
+		{"no labels", nil, true},
+		{"other manager", map[string]string{MANAGED_BY_LABEL: "helm", NETWORK_LABEL: "net"}, true},
+		{"other network", map[string]string{MANAGED_BY_LABEL: MANAGED_BY_VALUE, NETWORK_LABEL: "other"}, true},
+		{"network label missing", map[string]string{MANAGED_BY_LABEL: MANAGED_BY_VALUE}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNamespaceLabels(ownedNamespace(tt.labels, nil), ownershipConfig())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			var ownershipErr *OwnershipError
+			if err != nil && !errors.As(err, &ownershipErr) {
+				t.Fatalf("expected an OwnershipError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestResolveOwnership(t *testing.T) {
+	createdAt := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	requested := Ownership{
+		Creator:     "bob@laptop",
+		Version:     "v2",
+		NetworkHash: "hash",
+		CreatedAt:   createdAt.Add(time.Hour),
+	}
+	owned := map[string]string{MANAGED_BY_LABEL: MANAGED_BY_VALUE, NETWORK_LABEL: "net"}
+	recorded := func(hash string) map[string]string {
+		return map[string]string{
+			CREATOR_ANNOTATION:      "alice@laptop",
+			NETWORK_HASH_ANNOTATION: hash,
+			CREATED_AT_ANNOTATION:   createdAt.Format(time.RFC3339),
+		}
+	}
+	// the first creator and creation time are kept, version and hash are updated
+	kept := Ownership{
+		Creator:     "alice@laptop",
+		Version:     "v2",
+		NetworkHash: "hash",
+		CreatedAt:   createdAt,
+	}
+
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+		force     bool
+		want      Ownership
+		wantErr   bool
+	}{
+		{"new namespace", nil, false, requested, false},
+		{"same network file", ownedNamespace(owned, recorded("hash")), false, kept, false},
+		{"created before the hash was recorded", ownedNamespace(owned, recorded("")), false, kept, false},
+		{"other network file", ownedNamespace(owned, recorded("other")), false, requested, true},
+		{"other network file forced", ownedNamespace(owned, recorded("other")), true, requested, false},
+		{"foreign namespace", ownedNamespace(nil, nil), false, requested, true},
+		{"foreign namespace forced", ownedNamespace(nil, nil), true, requested, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			if tt.namespace != nil {
+				clientset = fake.NewSimpleClientset(tt.namespace)
+			}
+
+			got, err := ResolveOwnership(context.Background(), clientset, ownershipConfig(), requested, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got.Creator != tt.want.Creator || got.Version != tt.want.Version ||
+				got.NetworkHash != tt.want.NetworkHash || !got.CreatedAt.Equal(tt.want.CreatedAt) {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * pause.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// PAUSED_REPLICAS_ANNOTATION stores the replicas of a paused statefulset so resume can restore them
+const PAUSED_REPLICAS_ANNOTATION = ANNOTATION_PREFIX + "paused-replicas"
+
+// NODE_TYPES in the order they have to be started, they are stopped in reverse
+var NODE_TYPES = []string{"root", "validator", "api"}
+
+// PauseNetwork scales all nodes of the network to zero, the data volumes are kept
+func PauseNetwork(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	for i := len(NODE_TYPES) - 1; i >= 0; i-- {
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: NODE_TYPES[i]}
+
+		sts, err := clientset.AppsV1().StatefulSets(k8sConfig.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, paused := sts.Annotations[PAUSED_REPLICAS_ANNOTATION]; paused {
+			zap.L().Info("already paused", zap.String("statefulset", sts.Name))
+			continue
+		}
+		if len(sts.Spec.VolumeClaimTemplates) == 0 {
+			return fmt.Errorf("%s keeps its data in ephemeral storage, pausing would lose it", sts.Name)
+		}
+
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+
+		err = patchReplicas(ctx, clientset, sts, 0, strconv.Itoa(int(replicas)))
+		if err != nil {
+			return err
+		}
+
+		err = waitForScaleDown(ctx, clientset, k8sConfig, sts.Name)
+		if err != nil {
+			return err
+		}
+		zap.L().Info("paused", zap.String("statefulset", sts.Name), zap.Int32("replicas", replicas))
+	}
+	return nil
+}
+
+// ResumeNetwork restores the replicas of a paused network, every node type has to be ready before the next one is started
+func ResumeNetwork(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	for _, nodeType := range NODE_TYPES {
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: nodeType}
+
+		sts, err := clientset.AppsV1().StatefulSets(k8sConfig.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		raw, paused := sts.Annotations[PAUSED_REPLICAS_ANNOTATION]
+		if !paused {
+			zap.L().Info("not paused", zap.String("statefulset", sts.Name))
+			continue
+		}
+		replicas, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation on %s: %w", PAUSED_REPLICAS_ANNOTATION, sts.Name, err)
+		}
+		options.Replicas = int32(replicas)
+
+		err = patchReplicas(ctx, clientset, sts, options.Replicas, nil)
+		if err != nil {
+			return err
+		}
+
+		err = waitForStatefulSet(ctx, clientset, options)
+		if err != nil {
+			return err
+		}
+		zap.L().Info("resumed", zap.String("statefulset", sts.Name), zap.Int32("replicas", options.Replicas))
+	}
+	return nil
+}
+
+// IsPaused reports whether any node type of the network is paused
+func IsPaused(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (bool, error) {
+	for _, nodeType := range NODE_TYPES {
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: nodeType}
+
+		sts, err := clientset.AppsV1().StatefulSets(k8sConfig.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if _, paused := sts.Annotations[PAUSED_REPLICAS_ANNOTATION]; paused {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// patchReplicas scales the statefulset and sets the paused annotation in one step, a nil annotation removes it
+func patchReplicas(ctx context.Context, clientset *kubernetes.Clientset, sts *appsv1.StatefulSet, replicas int32, pausedReplicas interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				PAUSED_REPLICAS_ANNOTATION: pausedReplicas,
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.AppsV1().StatefulSets(sts.Namespace).Patch(ctx, sts.Name, types.MergePatchType, patch, metav1.PatchOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+func waitForScaleDown(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, name string) error {
+	ticker := time.NewTicker(DELETION_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		sts, err := clientset.AppsV1().StatefulSets(k8sConfig.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if sts.Status.Replicas == 0 {
+			return nil
+		}
+		zap.L().Debug("waiting for pods to terminate", zap.String("statefulset", name), zap.Int32("remaining", sts.Status.Replicas))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not wait for %s to scale down: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// how long VerifyResumed waits for the p-chain time to move past the resume
+const PCHAIN_ADVANCE_TIMEOUT = 2 * time.Minute
+
+// ResumeStatus is what VerifyResumed could confirm about a resumed network
+type ResumeStatus struct {
+	// Nodes are the validators that are bootstrapped and healthy
+	Nodes      []string
+	PChainTime time.Time
+	// PChainAdvanced is false if no block was accepted since the resume within PCHAIN_ADVANCE_TIMEOUT
+	PChainAdvanced bool
+}
+
+// VerifyResumed waits until every validator has bootstrapped all chains and reports itself healthy,
+// then waits for the p-chain time to move past resumedAt. The p-chain time only advances with the next block,
+// so on an idle network it may not, PChainAdvanced tells whether it did.
+func VerifyResumed(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, mode ConnectionMode, resumedAt time.Time) (ResumeStatus, error) {
+	status := ResumeStatus{}
+
+	numValidators, err := NumRunningValidators(ctx, clientset, k8sConfig)
+	if err != nil {
+		return status, err
+	}
+	for _, node := range NodeNames(int32(numValidators), 0) {
+		err = waitForHealthyNode(ctx, restClient, k8sConfig, mode, node)
+		if err != nil {
+			return status, err
+		}
+		status.Nodes = append(status.Nodes, node)
+	}
+
+	conn, err := ConnectToPod(ctx, restClient, k8sConfig, mode, "root-0")
+	if err != nil {
+		return status, err
+	}
+	defer conn.Close()
+
+	deadline := time.After(PCHAIN_ADVANCE_TIMEOUT)
+	for {
+		status.PChainTime, err = chainTimestamp(ctx, conn)
+		if err != nil {
+			return status, err
+		}
+		if status.PChainTime.After(resumedAt) {
+			status.PChainAdvanced = true
+			return status, nil
+		}
+		zap.L().Info("p-chain time has not moved past the resume yet", zap.Time("pChainTime", status.PChainTime))
+
+		select {
+		case <-ctx.Done():
+			return status, fmt.Errorf("could not wait for the p-chain to advance: %v", ctx.Err())
+		case <-deadline:
+			return status, nil
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
+
+func waitForHealthyNode(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, mode ConnectionMode, node string) error {
+	conn, err := ConnectToPod(ctx, restClient, k8sConfig, mode, node)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		err := isHealthy(ctx, conn)
+		if err == nil {
+			zap.L().Info("node is healthy", zap.String("node", node))
+			return nil
+		}
+		zap.L().Info("node is not healthy yet", zap.String("node", node), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not wait for %s to become healthy: %v", node, ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
+
+func isHealthy(ctx context.Context, conn *NodeConnection) error {
+	for _, chain := range []string{"P", "X", "C"} {
+		err := isChainBootstrapped(ctx, conn, chain)
+		if err != nil {
+			return err
+		}
+	}
+
+	body, err := conn.Post(ctx, "/ext/health", strings.NewReader(`{
+    "jsonrpc":"2.0",
+    "id"     :1,
+    "method" :"health.health"
+}`))
+	if err != nil {
+		return err
+	}
+
+	parsed := struct {
+		Result struct {
+			Healthy bool `json:"healthy"`
+		} `json:"result"`
+	}{}
+	err = json.Unmarshal(body, &parsed)
+	if err != nil {
+		return err
+	}
+	if !parsed.Result.Healthy {
+		return fmt.Errorf("node reports unhealthy checks")
+	}
+	return nil
+}
+
+func chainTimestamp(ctx context.Context, conn *NodeConnection) (time.Time, error) {
+	body, err := conn.Post(ctx, "/ext/bc/P", strings.NewReader(`{
+    "jsonrpc":"2.0",
+    "id"     :1,
+    "method" :"platform.getTimestamp",
+    "params" :{}
+}`))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	parsed := struct {
+		Result struct {
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"result"`
+	}{}
+	err = json.Unmarshal(body, &parsed)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsed.Result.Timestamp, nil
+}
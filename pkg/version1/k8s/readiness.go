@@ -0,0 +1,262 @@
+/*
+ * readiness.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/logging"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const POD_CHECK_INTERVAL = 10 * time.Second
+const CRASH_LOOP_RESTART_THRESHOLD = 3
+const UNSCHEDULABLE_GRACE_PERIOD = 5 * time.Minute
+const DIAGNOSTIC_LOG_LINES = int64(30)
+
+// waiting reasons that will not resolve without changing the spec
+var fatalWaitingReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+}
+
+// PodError is returned if a pod of a StatefulSet cannot become ready
+type PodError struct {
+	Pod    string
+	Reason string
+}
+
+func (e *PodError) Error() string {
+	return fmt.Sprintf("pod %s cannot become ready: %s", e.Pod, e.Reason)
+}
+
+func isStatefulSetReady(sts *appsv1.StatefulSet, replicas int32) bool {
+	return sts.Status.ObservedGeneration >= sts.Generation &&
+		sts.Status.UpdatedReplicas == replicas &&
+		sts.Status.AvailableReplicas == replicas
+}
+
+// waitForStatefulSet blocks until all replicas of the StatefulSet are updated and available.
+// It gives up when ctx is done or a pod is stuck (crash loop, image pull, unschedulable)
+// and logs the events and last log lines of the offending pods in that case.
+func waitForStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	stsClient := clientset.AppsV1().StatefulSets(options.Namespace)
+	logger := zap.L().With(logging.Phase(options.Type))
+
+	for {
+		sts, err := stsClient.Get(ctx, options.Name(), metav1.GetOptions{})
+		if err != nil {
+			return waitError(ctx, clientset, options, err)
+		}
+		if isStatefulSetReady(sts, options.Replicas) {
+			return nil
+		}
+
+		watcher, err := stsClient.Watch(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", options.Name()).String(),
+			ResourceVersion: sts.ResourceVersion,
+		})
+		if err != nil {
+			return waitError(ctx, clientset, options, err)
+		}
+
+		ready, err := watchStatefulSet(ctx, clientset, watcher, options)
+		watcher.Stop()
+		if err != nil {
+			return waitError(ctx, clientset, options, err)
+		}
+		if ready {
+			return nil
+		}
+
+		logger.Debug("statefulset watch closed, re-establishing")
+	}
+}
+
+// watchStatefulSet returns false without an error if the watch has to be re-established
+func watchStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, watcher watch.Interface, options stateFullSetOptions) (bool, error) {
+	logger := zap.L().With(logging.Phase(options.Type))
+
+	ticker := time.NewTicker(POD_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-ticker.C:
+			err := checkPods(ctx, clientset, options)
+			if err != nil {
+				return false, err
+			}
+		case event, ok := <-watcher.ResultChan():
+			if !ok || event.Type == watch.Error {
+				return false, nil
+			}
+
+			sts, ok := event.Object.(*appsv1.StatefulSet)
+			if !ok {
+				logger.Warn("unexpected watch event", zap.String("event", string(event.Type)))
+				continue
+			}
+
+			if isStatefulSetReady(sts, options.Replicas) {
+				return true, nil
+			}
+
+			logger.Info("waiting for statefulset to reach desired state", zap.Int32("available", sts.Status.AvailableReplicas), zap.Int32("desired", options.Replicas))
+		}
+	}
+}
+
+// checkPods returns a PodError if one of the pods is stuck
+func checkPods(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	selector, err := metav1.LabelSelectorAsSelector(options.Selector())
+	if err != nil {
+		return err
+	}
+
+	pods, err := clientset.CoreV1().Pods(options.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		reason := podProblem(pod, time.Now())
+		if reason != "" {
+			return &PodError{Pod: pod.Name, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// podProblem returns why the pod is stuck or an empty string if it is not
+func podProblem(pod corev1.Pod, now time.Time) string {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting == nil {
+			continue
+		}
+		reason := status.State.Waiting.Reason
+		if fatalWaitingReasons[reason] {
+			return fmt.Sprintf("container %s is waiting: %s %s", status.Name, reason, status.State.Waiting.Message)
+		}
+		if reason == "CrashLoopBackOff" && status.RestartCount >= CRASH_LOOP_RESTART_THRESHOLD {
+			return fmt.Sprintf("container %s is crash looping (%d restarts)", status.Name, status.RestartCount)
+		}
+	}
+
+	if pod.Status.Phase == corev1.PodPending {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse &&
+				condition.Reason == corev1.PodReasonUnschedulable && now.Sub(condition.LastTransitionTime.Time) > UNSCHEDULABLE_GRACE_PERIOD {
+				return fmt.Sprintf("unschedulable for more than %s: %s", UNSCHEDULABLE_GRACE_PERIOD, condition.Message)
+			}
+		}
+	}
+
+	return ""
+}
+
+// waitError logs the diagnostics of the pods that are not ready and wraps err
+func waitError(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions, err error) error {
+	// the diagnostics should still be fetched if the command timed out
+	diagCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if podErr, ok := err.(*PodError); ok {
+		logPodDiagnostics(diagCtx, clientset, options.Namespace, podErr.Pod)
+		return err
+	}
+
+	selector, selErr := metav1.LabelSelectorAsSelector(options.Selector())
+	if selErr == nil {
+		pods, listErr := clientset.CoreV1().Pods(options.Namespace).List(diagCtx, metav1.ListOptions{
+			LabelSelector: selector.String(),
+		})
+		if listErr == nil {
+			for _, pod := range pods.Items {
+				if !isPodReady(pod) {
+					logPodDiagnostics(diagCtx, clientset, options.Namespace, pod.Name)
+				}
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("could not wait for %s to become ready: %v", options.Name(), ctx.Err())
+	}
+	return fmt.Errorf("could not wait for %s to become ready: %w", options.Name(), err)
+}
+
+func isPodReady(pod corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// logPodDiagnostics logs the events and the last log lines of every container of the pod
+func logPodDiagnostics(ctx context.Context, clientset *kubernetes.Clientset, namespace string, podName string) {
+	logger := zap.L().With(zap.String("pod", podName))
+
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.name", podName).String(),
+	})
+	if err != nil {
+		logger.Warn("could not list pod events", zap.Error(err))
+	} else {
+		for _, event := range events.Items {
+			logger.Warn("pod event", zap.String("type", event.Type), zap.String("reason", event.Reason), zap.String("message", event.Message), zap.Int32("count", event.Count))
+		}
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		logger.Warn("could not get pod", zap.Error(err))
+		return
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.Ready || (status.State.Running == nil && status.LastTerminationState.Terminated == nil && status.State.Terminated == nil) {
+			continue
+		}
+
+		tailLines := DIAGNOSTIC_LOG_LINES
+		logs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+			Container: status.Name,
+			TailLines: &tailLines,
+			// a crash looping container has no current logs worth reading
+			Previous: status.State.Running == nil && status.LastTerminationState.Terminated != nil,
+		}).Stream(ctx)
+		if err != nil {
+			logger.Warn("could not read container logs", zap.String("container", status.Name), zap.Error(err))
+			continue
+		}
+
+		scanner := bufio.NewScanner(logs)
+		for scanner.Scan() {
+			logger.Warn("container log", zap.String("container", status.Name), zap.String("line", scanner.Text()))
+		}
+		logs.Close()
+	}
+}
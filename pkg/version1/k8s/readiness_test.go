@@ -0,0 +1,87 @@
+/*
+ * readiness_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func waitingPod(reason string, restarts int32) corev1.Pod {
+	return corev1.Pod{
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:         "node",
+					RestartCount: restarts,
+					State: corev1.ContainerState{
+						Waiting: &corev1.ContainerStateWaiting{Reason: reason},
+					},
+				},
+			},
+		},
+	}
+}
+
+func unschedulablePod(since time.Time) corev1.Pod {
+	return corev1.Pod{
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{
+				{
+					Type:               corev1.PodScheduled,
+					Status:             corev1.ConditionFalse,
+					Reason:             corev1.PodReasonUnschedulable,
+					Message:            "0/3 nodes are available",
+					LastTransitionTime: metav1.NewTime(since),
+				},
+			},
+		},
+	}
+}
+
+func TestPodProblem(t *testing.T) {
+	now := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	initPod := waitingPod("InvalidImageName", 0)
+	initPod.Status.InitContainerStatuses = initPod.Status.ContainerStatuses
+	initPod.Status.ContainerStatuses = nil
+
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want string
+	}{
+		{"running", corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}}, ""},
+		{"image pull backoff", waitingPod("ImagePullBackOff", 0), "ImagePullBackOff"},
+		{"invalid image name", waitingPod("InvalidImageName", 0), "InvalidImageName"},
+		{"config error", waitingPod("CreateContainerConfigError", 0), "CreateContainerConfigError"},
+		{"init container", initPod, "InvalidImageName"},
+		{"container creating", waitingPod("ContainerCreating", 0), ""},
+		{"first crash loops", waitingPod("CrashLoopBackOff", CRASH_LOOP_RESTART_THRESHOLD-1), ""},
+		{"crash looping", waitingPod("CrashLoopBackOff", CRASH_LOOP_RESTART_THRESHOLD), "crash looping"},
+		{"unschedulable within grace period", unschedulablePod(now.Add(-UNSCHEDULABLE_GRACE_PERIOD / 2)), ""},
+		{"unschedulable", unschedulablePod(now.Add(-2 * UNSCHEDULABLE_GRACE_PERIOD)), "unschedulable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := podProblem(tt.pod, now)
+			if tt.want == "" && got != "" {
+				t.Fatalf("expected no problem, got '%s'", got)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("expected a problem containing '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+#!/bin/bash
+# exits successfully if the node reports all given chains (default P, X and C) as bootstrapped
+# talks http through /dev/tcp as the node image does not ship curl
+
+CHAINS=${*:-"P X C"}
+
+for CHAIN in $CHAINS
+do
+    BODY="{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"info.isBootstrapped\",\"params\":{\"chain\":\"$CHAIN\"}}"
+
+    exec 3<>/dev/tcp/127.0.0.1/9650 || exit 1
+    printf 'POST /ext/info HTTP/1.0\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s' "${#BODY}" "$BODY" >&3
+    RESPONSE=$(cat <&3)
+    exec 3<&-
+
+    echo "$RESPONSE" | grep -q '"isBootstrapped":true' || exit 1
+done
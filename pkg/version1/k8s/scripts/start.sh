@@ -1,34 +1,49 @@
 #!/bin/bash
 set -xe
 
-NETWORK_ID=kopernikus
-
-HTTP_PARAMS="--http-host=0.0.0.0 --http-allowed-origins=* --http-port=9650"
-STAKING_PARAMS="--staking-tls-key-file=/mnt/cert/tls.key --staking-tls-cert-file=/mnt/cert/tls.crt --staking-port=9651"
-API_NODE_PARAMS="--index-enabled"
-
-BOOTSTRAP_PARAMS="--api-admin-enabled=true --log-level=debug"
-
-# if [ ! -d "/mnt/data/$NETWORK_ID" ];
-# then 
-if [ "${IS_ROOT:-"false"}" = true ] && [ ! -d "/mnt/data/$NETWORK_ID" ];
-then 
-    BOOTSTRAP_PARAMS="$BOOTSTRAP_PARAMS --bootstrap-ids= --bootstrap-ips="
-else 
-    ROOT_PORT="${NETWORK_NAME^^}_ROOT_SERVICE_PORT_STAKING"
-    ROOT_HOST="${NETWORK_NAME^^}_ROOT_SERVICE_HOST"
-    BOOTSTRAP_PARAMS="$BOOTSTRAP_PARAMS --bootstrap-ids=$ROOT_NODE_ID --bootstrap-ips=${!ROOT_HOST}:${!ROOT_PORT}"
+# everything but the public ip and the bootstrap nodes comes from the config.json of the role (NODE_CONFIG_FILE)
+
+# the root node starts the chain, every other start bootstraps from the bootstrap nodes (BOOTSTRAP_HOSTS and BOOTSTRAP_ID_<i>)
+BOOTSTRAP_IDS=""
+BOOTSTRAP_IPS=""
+# an empty data volume (ext4 volumes come with lost+found) means the chain does not exist yet
+if [ "${IS_ROOT:-"false"}" != true ] || [ -n "$(find /mnt/data -mindepth 1 -maxdepth 1 ! -name lost+found)" ];
+then
+    while true
+    do
+        INDEX=0
+        OTHERS=0
+        for HOST in $BOOTSTRAP_HOSTS
+        do
+            ID_VAR="BOOTSTRAP_ID_$INDEX"
+            INDEX=$((INDEX + 1))
+            # a node does not bootstrap from itself
+            if [ "${HOST%%.*}" = "$HOSTNAME" ]; then continue; fi
+            OTHERS=$((OTHERS + 1))
+
+            # the bootstrap ips cannot be host names, pods without an ip yet are skipped
+            IP=$(getent hosts "$HOST" | awk '{ print $1; exit }')
+            if [ -z "$IP" ]; then continue; fi
+            BOOTSTRAP_IDS="${BOOTSTRAP_IDS:+$BOOTSTRAP_IDS,}${!ID_VAR}"
+            BOOTSTRAP_IPS="${BOOTSTRAP_IPS:+$BOOTSTRAP_IPS,}$IP:9651"
+        done
+
+        # the only bootstrap node starts on its own
+        if [ -n "$BOOTSTRAP_IPS" ] || [ "$OTHERS" = 0 ]; then break; fi
+        echo "waiting for one of the bootstrap nodes to get an address"
+        sleep 5
+    done
 fi
-# fi
 
-CMD="--network-id=$NETWORK_ID --public-ip=$POD_IP --db-dir=/mnt/data --genesis=/mnt/conf/genesis.json $BOOTSTRAP_PARAMS $HTTP_PARAMS"
-if [ "${IS_API_NODE:="false"}" = true ];
+CMD="--config-file=$NODE_CONFIG_FILE --public-ip=$POD_IP --bootstrap-ids=$BOOTSTRAP_IDS --bootstrap-ips=$BOOTSTRAP_IPS"
+
+# validators get the staker secrets of all pods of their role projected to /mnt/stakers/<index>
+if [ -n "${STAKER_OFFSET:-}" ];
 then
-    CMD="$CMD $API_NODE_PARAMS"
-else
-    CMD="$CMD $STAKING_PARAMS"
+    STAKER_INDEX=$((${HOSTNAME##*-} + $STAKER_OFFSET))
+    CMD="$CMD --staking-tls-key-file=/mnt/stakers/$STAKER_INDEX/tls.key --staking-tls-cert-file=/mnt/stakers/$STAKER_INDEX/tls.crt"
 fi
 
 echo $CMD > cmd.txt
 
-./camino-node $CMD
\ No newline at end of file
+./camino-node $CMD
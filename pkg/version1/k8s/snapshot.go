@@ -0,0 +1,593 @@
+/*
+ * snapshot.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"github.com/ava-labs/avalanchego/genesis"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	SNAPSHOT_METHOD_VOLUME = "volumesnapshot"
+	SNAPSHOT_METHOD_TAR    = "tar"
+)
+
+var SNAPSHOT_METHODS = []string{SNAPSHOT_METHOD_VOLUME, SNAPSHOT_METHOD_TAR}
+
+func ParseSnapshotMethod(method string) (string, error) {
+	return parseEnum("snapshot method", method, SNAPSHOT_METHODS)
+}
+
+const (
+	SNAPSHOT_MANIFEST_FILE = "manifest.json"
+	SNAPSHOT_NETWORK_FILE  = "network.json"
+	SNAPSHOT_GENESIS_FILE  = "genesis.json"
+)
+
+const SNAPSHOT_API_GROUP = "snapshot.storage.k8s.io"
+
+// DATA_DIR is where the data volume is mounted in the node containers
+const DATA_DIR = "/mnt/data"
+
+var volumeSnapshots = schema.GroupVersionResource{Group: SNAPSHOT_API_GROUP, Version: "v1", Resource: "volumesnapshots"}
+var volumeSnapshotContents = schema.GroupVersionResource{Group: SNAPSHOT_API_GROUP, Version: "v1", Resource: "volumesnapshotcontents"}
+
+// SnapshotManifest describes a snapshot directory, the data of every node is either
+// a volume snapshot on the cluster or a tarball next to the manifest
+type SnapshotManifest struct {
+	Name          string         `json:"name"`
+	Network       string         `json:"network"`
+	Method        string         `json:"method"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Version       string         `json:"version"`
+	Image         string         `json:"image"`
+	NumValidators int32          `json:"numValidators"`
+	NumApiNodes   int32          `json:"numApiNodes"`
+	Volumes       []NodeSnapshot `json:"volumes"`
+}
+
+// NodeSnapshot is the data volume of a single node
+type NodeSnapshot struct {
+	Type  string `json:"type"`
+	Index int32  `json:"index"`
+	Size  string `json:"size"`
+	// set for volume snapshots, enough to import the snapshot into any namespace
+	Driver         string `json:"driver,omitempty"`
+	SnapshotHandle string `json:"snapshotHandle,omitempty"`
+	// set for tarballs, relative to the snapshot directory
+	Archive string `json:"archive,omitempty"`
+}
+
+// Node is the name of the node without the network prefix, e.g. validator-0
+func (n NodeSnapshot) Node() string {
+	return fmt.Sprintf("%s-%d", n.Type, n.Index)
+}
+
+// claimName is the name the statefulset controller gives the data volume of the node
+func claimName(k8sConfig version1.K8sConfig, node string) string {
+	return "data-vol-" + k8sConfig.PrefixWith(node)
+}
+
+// LoadSnapshotManifest reads the manifest of a snapshot directory
+func LoadSnapshotManifest(dir string) (*SnapshotManifest, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, SNAPSHOT_MANIFEST_FILE))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &SnapshotManifest{}
+	err = json.Unmarshal(raw, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot manifest in %s: %w", dir, err)
+	}
+	return manifest, nil
+}
+
+// WriteSnapshotManifest writes the manifest into the snapshot directory
+func WriteSnapshotManifest(dir string, manifest *SnapshotManifest) error {
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, SNAPSHOT_MANIFEST_FILE), raw, 0644)
+}
+
+// LiveGenesis returns the genesis the network was started with, byte for byte
+func LiveGenesis(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) ([]byte, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, k8sConfig.K8sPrefix, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := configMap.BinaryData["genesis.json"]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s has no genesis", configMap.Name)
+	}
+	return raw, nil
+}
+
+// ParseGenesis parses a genesis written by LiveGenesis
+func ParseGenesis(raw []byte) (genesis.UnparsedConfig, error) {
+	genesisConfig := genesis.UnparsedConfig{}
+	err := json.Unmarshal(raw, &genesisConfig)
+	return genesisConfig, err
+}
+
+// SnapshotNetwork captures the data volume of every node of the network into dir.
+// Volume snapshots stay on the cluster and only their handles are recorded, tarballs are streamed out of the running pods.
+func SnapshotNetwork(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, manifest *SnapshotManifest, snapshotClass string, dir string) error {
+	volumes, err := networkVolumes(ctx, clientset, k8sConfig, manifest)
+	if err != nil {
+		return err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	for _, volume := range volumes {
+		logger := zap.L().With(zap.String("node", volume.Node()))
+		switch manifest.Method {
+		case SNAPSHOT_METHOD_VOLUME:
+			err = snapshotVolume(ctx, dynamicClient, k8sConfig, manifest.Name, snapshotClass, &volume)
+		case SNAPSHOT_METHOD_TAR:
+			err = snapshotTar(ctx, restClient, clientset, k8sConfig, dir, &volume)
+		default:
+			err = fmt.Errorf("unknown snapshot method '%s'", manifest.Method)
+		}
+		if err != nil {
+			return fmt.Errorf("could not snapshot %s: %w", volume.Node(), err)
+		}
+		logger.Info("captured node data")
+		manifest.Volumes = append(manifest.Volumes, volume)
+	}
+	return nil
+}
+
+// networkVolumes lists the data volumes of all nodes, including those of a paused network
+func networkVolumes(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, manifest *SnapshotManifest) ([]NodeSnapshot, error) {
+	volumes := []NodeSnapshot{}
+	for _, nodeType := range NODE_TYPES {
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: nodeType}
+
+		sts, err := clientset.AppsV1().StatefulSets(k8sConfig.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(sts.Spec.VolumeClaimTemplates) == 0 {
+			return nil, fmt.Errorf("%s keeps its data in ephemeral storage which cannot be snapshotted", sts.Name)
+		}
+
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		if raw, paused := sts.Annotations[PAUSED_REPLICAS_ANNOTATION]; paused {
+			parsed, err := strconv.ParseInt(raw, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s annotation on %s: %w", PAUSED_REPLICAS_ANNOTATION, sts.Name, err)
+			}
+			replicas = int32(parsed)
+		}
+
+		if nodeType == "api" {
+			manifest.NumApiNodes = replicas
+		} else {
+			manifest.NumValidators += replicas
+		}
+		for _, c := range sts.Spec.Template.Spec.Containers {
+			if c.Name == "camino-node" && (nodeType == "root" || manifest.Image == "") {
+				manifest.Image = c.Image
+			}
+		}
+
+		for i := int32(0); i < replicas; i++ {
+			volume := NodeSnapshot{Type: nodeType, Index: i}
+			pvc, err := clientset.CoreV1().PersistentVolumeClaims(k8sConfig.Namespace).Get(ctx, claimName(k8sConfig, volume.Node()), metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+			volume.Size = size.String()
+			volumes = append(volumes, volume)
+		}
+	}
+	return volumes, nil
+}
+
+// snapshotVolume takes a csi snapshot of the data volume and retains its content,
+// so the snapshot survives the deletion of the network
+func snapshotVolume(ctx context.Context, dynamicClient dynamic.Interface, k8sConfig version1.K8sConfig, snapshotName string, snapshotClass string, volume *NodeSnapshot) error {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": claimName(k8sConfig, volume.Node()),
+		},
+	}
+	if snapshotClass != "" {
+		spec["volumeSnapshotClassName"] = snapshotClass
+	}
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": SNAPSHOT_API_GROUP + "/v1",
+		"kind":       "VolumeSnapshot",
+		"spec":       spec,
+	}}
+	snapshot.SetName(fmt.Sprintf("%s-%s", snapshotName, volume.Node()))
+	snapshot.SetNamespace(k8sConfig.Namespace)
+	snapshot.SetLabels(k8sConfig.Labels)
+
+	_, err := applyObject(ctx, dynamicClient, snapshot, false)
+	if err != nil {
+		return err
+	}
+
+	contentName, err := waitForVolumeSnapshot(ctx, dynamicClient, k8sConfig.Namespace, snapshot.GetName())
+	if err != nil {
+		return err
+	}
+
+	contentClient := dynamicClient.Resource(volumeSnapshotContents)
+	content, err := contentClient.Get(ctx, contentName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	volume.Driver, _, _ = unstructured.NestedString(content.Object, "spec", "driver")
+	volume.SnapshotHandle, _, _ = unstructured.NestedString(content.Object, "status", "snapshotHandle")
+	if volume.Driver == "" || volume.SnapshotHandle == "" {
+		return fmt.Errorf("volume snapshot content %s has no driver or snapshot handle", contentName)
+	}
+	if restoreSize, found, _ := unstructured.NestedInt64(content.Object, "status", "restoreSize"); found && restoreSize > 0 {
+		volume.Size = resource.NewQuantity(restoreSize, resource.BinarySI).String()
+	}
+
+	// patched instead of applied, the content is owned by the snapshot controller
+	_, err = contentClient.Patch(ctx, contentName, types.MergePatchType, []byte(`{"spec":{"deletionPolicy":"Retain"}}`), metav1.PatchOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+// waitForVolumeSnapshot waits until the snapshot is ready to use and returns the name of its content
+func waitForVolumeSnapshot(ctx context.Context, dynamicClient dynamic.Interface, namespace string, name string) (string, error) {
+	ticker := time.NewTicker(DELETION_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		snapshot, err := dynamicClient.Resource(volumeSnapshots).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+			return "", fmt.Errorf("volume snapshot %s failed: %s", name, message)
+		}
+		ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		contentName, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+		if ready && contentName != "" {
+			return contentName, nil
+		}
+		zap.L().Debug("waiting for volume snapshot", zap.String("snapshot", name))
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("could not wait for volume snapshot %s: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshotTar streams a tarball of the data directory out of the running node
+func snapshotTar(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, dir string, volume *NodeSnapshot) error {
+	volume.Archive = volume.Node() + ".tar.gz"
+
+	file, err := os.Create(filepath.Join(dir, volume.Archive))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	command := []string{"tar", "-C", DATA_DIR, "-czf", "-", "."}
+	err = execInPod(ctx, restClient, clientset, k8sConfig.Namespace, k8sConfig.PrefixWith(volume.Node()), "camino-node", command, nil, file)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// execInPod runs command in a container of the pod, stdin may be nil
+func execInPod(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, namespace string, podName string, container string, command []string, stdin io.Reader, stdout io.Writer) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(restClient, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	stderr := &strings.Builder{}
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Stream(remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("could not run %s in %s: %w", command[0], podName, ctx.Err())
+	case err = <-done:
+	}
+	if err != nil {
+		return fmt.Errorf("could not run %s in %s: %w: %s", command[0], podName, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// SeedVolumes creates the data volumes of a new network from a snapshot, before its statefulsets are created.
+// The statefulset controller adopts a claim with the expected name instead of provisioning an empty one.
+func SeedVolumes(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, manifest *SnapshotManifest, dir string) error {
+	for _, volume := range manifest.Volumes {
+		if k8sConfig.Resources.Storage.ForRole(volume.Type).Ephemeral {
+			return fmt.Errorf("cannot restore %s into ephemeral storage", volume.Node())
+		}
+
+		var err error
+		switch manifest.Method {
+		case SNAPSHOT_METHOD_VOLUME:
+			var objs []runtime.Object
+			objs, err = buildRestoredVolume(k8sConfig, volume)
+			if err == nil {
+				err = applyObjects(ctx, restClient, objs...)
+			}
+		case SNAPSHOT_METHOD_TAR:
+			err = seedFromTar(ctx, restClient, clientset, k8sConfig, dir, volume)
+		default:
+			err = fmt.Errorf("unknown snapshot method '%s'", manifest.Method)
+		}
+		if err != nil {
+			return fmt.Errorf("could not restore %s: %w", volume.Node(), err)
+		}
+		zap.L().Info("restored node data", zap.String("node", volume.Node()))
+	}
+	return nil
+}
+
+// buildDataClaim claims the data volume of a node in the storage class of its role, large enough for the snapshot
+func buildDataClaim(k8sConfig version1.K8sConfig, volume NodeSnapshot, dataSource *corev1.TypedLocalObjectReference) (*corev1.PersistentVolumeClaim, error) {
+	options := stateFullSetOptions{K8sConfig: k8sConfig, Type: volume.Type}
+
+	claim := buildDataVolumeClaimTemplate(k8sConfig.Resources.Storage.ForRole(volume.Type))
+	claim.Name = claimName(k8sConfig, volume.Node())
+	claim.Namespace = k8sConfig.Namespace
+	// the same labels the statefulset controller puts on the claims it creates
+	claim.Labels = options.Labels()
+	claim.Spec.DataSource = dataSource
+
+	snapshotSize, err := resource.ParseQuantity(volume.Size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size '%s' of %s in the snapshot: %w", volume.Size, volume.Node(), err)
+	}
+	if snapshotSize.Cmp(claim.Spec.Resources.Requests[corev1.ResourceStorage]) > 0 {
+		claim.Spec.Resources.Requests[corev1.ResourceStorage] = snapshotSize
+	}
+	return &claim, nil
+}
+
+// buildRestoredVolume imports the snapshot handle as a pre-provisioned snapshot and claims a volume from it
+func buildRestoredVolume(k8sConfig version1.K8sConfig, volume NodeSnapshot) ([]runtime.Object, error) {
+	name := claimName(k8sConfig, volume.Node())
+
+	content := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": SNAPSHOT_API_GROUP + "/v1",
+		"kind":       "VolumeSnapshotContent",
+		"spec": map[string]interface{}{
+			"deletionPolicy": "Retain",
+			"driver":         volume.Driver,
+			"source": map[string]interface{}{
+				"snapshotHandle": volume.SnapshotHandle,
+			},
+			"volumeSnapshotRef": map[string]interface{}{
+				"name":      name,
+				"namespace": k8sConfig.Namespace,
+			},
+		},
+	}}
+	content.SetName(fmt.Sprintf("%s-%s", k8sConfig.Namespace, name))
+	content.SetLabels(k8sConfig.Labels)
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": SNAPSHOT_API_GROUP + "/v1",
+		"kind":       "VolumeSnapshot",
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"volumeSnapshotContentName": content.GetName(),
+			},
+		},
+	}}
+	snapshot.SetName(name)
+	snapshot.SetNamespace(k8sConfig.Namespace)
+	snapshot.SetLabels(k8sConfig.Labels)
+
+	apiGroup := SNAPSHOT_API_GROUP
+	claim, err := buildDataClaim(k8sConfig, volume, &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     "VolumeSnapshot",
+		Name:     name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []runtime.Object{content, snapshot, claim}, nil
+}
+
+func buildSeedPod(k8sConfig version1.K8sConfig, volume NodeSnapshot) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k8sConfig.PrefixWith("seed-" + volume.Node()),
+			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyNever,
+			ImagePullSecrets: []corev1.LocalObjectReference{
+				{
+					Name: k8sConfig.PullSecretName,
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "seed",
+					Image:   k8sConfig.Image,
+					Command: []string{"sleep", "infinity"},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      "data-vol",
+							MountPath: DATA_DIR,
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "data-vol",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: claimName(k8sConfig, volume.Node()),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// seedFromTar claims an empty volume and unpacks the tarball into it from a temporary pod
+func seedFromTar(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, dir string, volume NodeSnapshot) error {
+	file, err := os.Open(filepath.Join(dir, volume.Archive))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	claim, err := buildDataClaim(k8sConfig, volume, nil)
+	if err != nil {
+		return err
+	}
+	pod := buildSeedPod(k8sConfig, volume)
+	err = applyObjects(ctx, restClient, claim, pod)
+	if err != nil {
+		return err
+	}
+
+	err = waitForPodRunning(ctx, clientset, pod.Namespace, pod.Name)
+	if err == nil {
+		err = execInPod(ctx, restClient, clientset, pod.Namespace, pod.Name, "seed", []string{"tar", "-C", DATA_DIR, "-xzf", "-"}, file, nil)
+	}
+
+	// the volume can only be mounted by the node once the seed pod is gone
+	deleteErr := deletePod(ctx, clientset, pod.Namespace, pod.Name)
+	if err != nil {
+		return err
+	}
+	return deleteErr
+}
+
+func waitForPodRunning(ctx context.Context, clientset *kubernetes.Clientset, namespace string, name string) error {
+	ticker := time.NewTicker(DELETION_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return nil
+		case corev1.PodFailed, corev1.PodSucceeded:
+			return fmt.Errorf("pod %s stopped unexpectedly", name)
+		}
+		if problem := podProblem(*pod, time.Now()); problem != "" {
+			return &PodError{Pod: name, Reason: problem}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not wait for pod %s: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func deletePod(ctx context.Context, clientset *kubernetes.Clientset, namespace string, name string) error {
+	gracePeriod := int64(0)
+	err := clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(DELETION_CHECK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		_, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not wait for the deletion of pod %s: %w", name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
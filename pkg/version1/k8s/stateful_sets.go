@@ -10,20 +10,34 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"chain4travel.com/camktncr/pkg/version1"
 	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
-	promVersioned "github.com/prometheus-operator/prometheus-operator/pkg/client/versioned"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
-func buildService(options stateFullSetOptions) corev1.Service {
+var ANTI_AFFINITY_MODES = []string{version1.ANTI_AFFINITY_NONE, version1.ANTI_AFFINITY_PREFERRED, version1.ANTI_AFFINITY_REQUIRED}
+
+func ParseAntiAffinity(mode string) (string, error) {
+	return parseEnum("anti-affinity", mode, ANTI_AFFINITY_MODES)
+}
+
+const PROBE_PERIOD_SECONDS = 10
+const PROBE_TIMEOUT_SECONDS = 5
+
+// STAKERS_DIR is where the staker secrets of a validator role are projected
+const STAKERS_DIR = "/mnt/stakers"
+
+func buildService(options stateFullSetOptions) *corev1.Service {
 
 	servicePorts := []corev1.ServicePort{
 		{Name: "rpc", Port: 9650, TargetPort: intstr.FromInt(9650)},
@@ -33,7 +47,7 @@ func buildService(options stateFullSetOptions) corev1.Service {
 			corev1.ServicePort{Name: "staking", Port: 9651, TargetPort: intstr.FromInt(9651)})
 	}
 
-	return corev1.Service{
+	return &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      options.Name(),
 			Namespace: options.Namespace,
@@ -48,72 +62,120 @@ func buildService(options stateFullSetOptions) corev1.Service {
 	}
 }
 
-func createStatefulSetWithOptions(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
-	svc := buildService(options)
+// headlessServiceName is the governing service of a statefulset, it gives every pod a stable dns name
+func headlessServiceName(options stateFullSetOptions) string {
+	return options.PrefixWith(options.Type + "-headless")
+}
 
-	serviceClient := clientset.CoreV1().Services(options.Namespace)
-	_, foundErr := serviceClient.Get(ctx, options.Name(), metav1.GetOptions{})
-	if foundErr == nil {
-		_, err := serviceClient.Update(ctx, &svc, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
+// buildHeadlessService publishes the pods before they are ready, a restarting bootstrap node
+// has to find the others while none of them is bootstrapped
+func buildHeadlessService(options stateFullSetOptions) *corev1.Service {
+	servicePorts := []corev1.ServicePort{
+		{Name: "rpc", Port: NODE_API_PORT, TargetPort: intstr.FromInt(NODE_API_PORT)},
+	}
+	if options.IsValidator {
+		servicePorts = append(servicePorts,
+			corev1.ServicePort{Name: "staking", Port: NODE_STAKING_PORT, TargetPort: intstr.FromInt(NODE_STAKING_PORT)})
+	}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceName(options),
+			Namespace: options.Namespace,
+			Labels:    options.K8sConfig.Labels,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			Ports:                    servicePorts,
+			Selector:                 options.Labels(),
+			PublishNotReadyAddresses: true,
+		},
+	}
+}
+
+// buildStatefulSetObjects returns everything that makes up a node role in the order it is applied
+func buildStatefulSetObjects(options stateFullSetOptions) []runtime.Object {
+	sts := baseStateFullSet(options)
+	objs := []runtime.Object{buildService(options), buildHeadlessService(options)}
+	objs = append(objs, buildNodeServices(options)...)
+	objs = append(objs, &sts)
+	if options.EnableMonitoring {
+		objs = append(objs, buildServiceMonitor(options))
+	}
+	return objs
+}
+
+// CheckGoverningServices fails if a statefulset of the network has a different governing service,
+// e.g. one created by an older version. The service name of a statefulset cannot be changed, an apply would be rejected.
+func CheckGoverningServices(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	for _, nodeType := range NODE_TYPES {
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: nodeType}
+
+		sts, err := clientset.AppsV1().StatefulSets(k8sConfig.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
 		}
-	} else { //TODO CHECK FOR ACTUAL NOT FOUND ERROR
-		_, err := serviceClient.Create(ctx, &svc, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
 		if err != nil {
 			return err
 		}
+		if sts.Spec.ServiceName != headlessServiceName(options) {
+			return fmt.Errorf("statefulset %s has the governing service '%s' instead of '%s' and cannot be updated in place, "+
+				"destroy the network with --keep-disks and create it again to keep the chain data", sts.Name, sts.Spec.ServiceName, headlessServiceName(options))
+		}
+	}
+	return nil
+}
+
+func createStatefulSetWithOptions(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	dynamicClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	_, err = applyObject(ctx, dynamicClient, buildService(options), false)
+	if err != nil {
+		return err
+	}
+
+	_, err = applyObject(ctx, dynamicClient, buildHeadlessService(options), false)
+	if err != nil {
+		return err
+	}
+
+	err = applyNodeServices(ctx, dynamicClient, clientset, options)
+	if err != nil {
+		return err
 	}
 
 	sts := baseStateFullSet(options)
+	applied, err := applyObject(ctx, dynamicClient, &sts, false)
+	if err != nil {
+		return err
+	}
 
-	stsClient := clientset.AppsV1().StatefulSets(options.Namespace)
-	var createdSts *appsv1.StatefulSet
-	_, foundErr = stsClient.Get(ctx, options.Name(), metav1.GetOptions{})
-	var err error
-	if foundErr == nil {
-		createdSts, err = stsClient.Update(ctx, &sts, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	} else { //TODO CHECK FOR ACTUAL NOT FOUND ERROR
-		createdSts, err = stsClient.Create(ctx, &sts, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
+	appliedSts := &appsv1.StatefulSet{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(applied.Object, appliedSts)
+	if err != nil {
+		return err
+	}
+
+	// applying the desired replicas ends a pause
+	if _, paused := appliedSts.Annotations[PAUSED_REPLICAS_ANNOTATION]; paused {
+		err = patchReplicas(ctx, clientset, appliedSts, options.Replicas, nil)
 		if err != nil {
 			return err
 		}
 	}
 
-	if createdSts.Status.UpdatedReplicas != options.Replicas || createdSts.Status.AvailableReplicas != options.Replicas {
-		watch, err := stsClient.Watch(ctx, metav1.SingleObject(createdSts.ObjectMeta))
+	if !isStatefulSetReady(appliedSts, options.Replicas) {
+		err = waitForStatefulSet(ctx, clientset, options)
 		if err != nil {
 			return err
 		}
-		for event := range watch.ResultChan() {
-			sts, ok := event.Object.(*appsv1.StatefulSet)
-			if !ok {
-				fmt.Println("could not parse", event)
-				continue
-			}
-
-			if sts.Status.AvailableReplicas == options.Replicas && sts.Status.UpdatedReplicas == options.Replicas {
-				watch.Stop()
-			}
-
-			fmt.Printf("waiting for %s to reach desired state [%d/%d]\n", options.Type, sts.Status.AvailableReplicas, options.Replicas)
-		}
-
 	}
 
 	if options.EnableMonitoring {
-		err := createServiceMonitor(ctx, restClient, options)
+		_, err := applyObject(ctx, dynamicClient, buildServiceMonitor(options), false)
 		if err != nil {
 			return err
 		}
@@ -125,11 +187,22 @@ func createStatefulSetWithOptions(ctx context.Context, restClient *rest.Config,
 func baseStateFullSet(options stateFullSetOptions) appsv1.StatefulSet {
 
 	labels := options.Labels()
+	enableServiceLinks := false
 
-	initContainers := make([]corev1.Container, 0)
-
+	volumes := defaultVolumes(options.K8sConfig)
 	if options.IsValidator {
-		initContainers = append(initContainers, validatorInitContainer(options))
+		volumes = append(volumes, stakersVolume(options))
+	}
+	configVolumes, _ := nodeConfigVolumes(options.K8sConfig)
+	volumes = append(volumes, configVolumes...)
+	var volumeClaimTemplates []corev1.PersistentVolumeClaim
+	if options.Storage.Ephemeral {
+		volumes = append(volumes, corev1.Volume{
+			Name: "data-vol", VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			}})
+	} else {
+		volumeClaimTemplates = append(volumeClaimTemplates, buildDataVolumeClaimTemplate(options.Storage))
 	}
 
 	return appsv1.StatefulSet{
@@ -139,6 +212,8 @@ func baseStateFullSet(options stateFullSetOptions) appsv1.StatefulSet {
 			Labels:    labels,
 		},
 		Spec: appsv1.StatefulSetSpec{
+			// every pod is reachable under <pod>.<headless service>
+			ServiceName:         headlessServiceName(options),
 			PodManagementPolicy: appsv1.ParallelPodManagement,
 			Replicas:            &options.Replicas,
 			Selector: &metav1.LabelSelector{
@@ -147,6 +222,9 @@ func baseStateFullSet(options stateFullSetOptions) appsv1.StatefulSet {
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					Annotations: map[string]string{
+						NODE_CONFIG_HASH_ANNOTATION: nodeConfigHash(options.K8sConfig, options.Type),
+					},
 				},
 				Spec: corev1.PodSpec{
 					ImagePullSecrets: []corev1.LocalObjectReference{
@@ -154,34 +232,79 @@ func baseStateFullSet(options stateFullSetOptions) appsv1.StatefulSet {
 							Name: options.PullSecretName,
 						},
 					},
-					ServiceAccountName: options.PrefixWith("init-container"),
-					InitContainers:     initContainers,
+					// the nodes find each other through dns, the docker link variables of all services are not needed
+					EnableServiceLinks: &enableServiceLinks,
 					Containers: []corev1.Container{
 						buildContainer(options),
 					},
-					Volumes: defaultVolumes(options.K8sConfig),
+					Volumes:      volumes,
+					NodeSelector: options.Scheduling.NodeSelector,
+					Tolerations:  options.Scheduling.Tolerations,
+					Affinity:     buildAffinity(options),
 				},
 			},
-			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "data-vol",
-					},
-					Spec: corev1.PersistentVolumeClaimSpec{
-						AccessModes: []corev1.PersistentVolumeAccessMode{
-							corev1.ReadWriteOnce,
-						},
-						Resources: corev1.ResourceRequirements{
-							Requests: corev1.ResourceList{
-								corev1.ResourceStorage: resource.MustParse("10Gi"),
-							},
-						},
-					},
+			VolumeClaimTemplates: volumeClaimTemplates,
+		},
+	}
+
+}
+
+// buildAffinity keeps the pods of a role apart, validators also stay apart from the root node
+// as both of them produce blocks
+func buildAffinity(options stateFullSetOptions) *corev1.Affinity {
+	scheduling := options.Scheduling
+	if scheduling.AntiAffinity == "" || scheduling.AntiAffinity == version1.ANTI_AFFINITY_NONE {
+		return nil
+	}
+
+	selector := &metav1.LabelSelector{MatchLabels: options.Labels()}
+	if options.IsValidator {
+		selector = &metav1.LabelSelector{
+			MatchLabels: options.K8sConfig.Labels,
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "type", Operator: metav1.LabelSelectorOpIn, Values: []string{"root", "validator"}},
+			},
+		}
+	}
+
+	term := corev1.PodAffinityTerm{
+		LabelSelector: selector,
+		TopologyKey:   scheduling.TopologyKey,
+	}
+
+	antiAffinity := &corev1.PodAntiAffinity{}
+	if scheduling.AntiAffinity == version1.ANTI_AFFINITY_REQUIRED {
+		antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = []corev1.PodAffinityTerm{term}
+	} else {
+		antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = []corev1.WeightedPodAffinityTerm{
+			{Weight: 100, PodAffinityTerm: term},
+		}
+	}
+	return &corev1.Affinity{PodAntiAffinity: antiAffinity}
+}
+
+func buildDataVolumeClaimTemplate(storage version1.K8sStorage) corev1.PersistentVolumeClaim {
+	var storageClass *string
+	if storage.StorageClass != "" {
+		storageClass = &storage.StorageClass
+	}
+
+	return corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "data-vol",
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			StorageClassName: storageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: storage.Size,
 				},
 			},
 		},
 	}
-
 }
 
 func buildContainer(options stateFullSetOptions) corev1.Container {
@@ -193,13 +316,15 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 		},
 	}
 
-	volumeMounts := defaultVolumeMounts()
+	_, nodeConfigMounts := nodeConfigVolumes(options.K8sConfig)
+	volumeMounts := append(defaultVolumeMounts(), nodeConfigMounts...)
 
 	if options.IsValidator {
 		ports = append(ports, corev1.ContainerPort{Name: "staking", ContainerPort: 9651})
 		volumeMounts = append(volumeMounts, corev1.VolumeMount{
-			Name:      "cert-vol",
-			MountPath: "/mnt/cert",
+			Name:      "stakers-vol",
+			MountPath: STAKERS_DIR,
+			ReadOnly:  true,
 		})
 	}
 
@@ -208,35 +333,14 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 		Image: options.Image,
 		Resources: corev1.ResourceRequirements{
 			Requests: options.Requests,
+			Limits:   options.Limits,
 		},
-		// LivenessProbe: &corev1.Probe{
-		// 	ProbeHandler: corev1.ProbeHandler{
-		// 		Exec: &corev1.ExecAction{
-		// 			Command: ,
-		// 		},
-		// 	},
-		// },
-		Env: []corev1.EnvVar{
-			{
-				Name: "ROOT_NODE_ID",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: fmt.Sprintf("%s-0", options.K8sPrefix),
-						},
-						Key: "Node-ID",
-					},
-				},
+		Env: append(bootstrapEnv(options.K8sConfig),
+			corev1.EnvVar{
+				Name:  "NODE_CONFIG_FILE",
+				Value: nodeConfigFile(options.Type),
 			},
-			{
-				Name:  "NETWORK_NAME",
-				Value: options.K8sPrefix,
-			},
-			{
-				Name:  "IS_API_NODE",
-				Value: strconv.FormatBool(!(options.IsValidator || options.IsRoot)),
-			},
-			{
+			corev1.EnvVar{
 				Name: "POD_IP",
 				ValueFrom: &corev1.EnvVarSource{
 					FieldRef: &corev1.ObjectFieldSelector{
@@ -244,11 +348,11 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 					},
 				},
 			},
-			{
+			corev1.EnvVar{
 				Name:  "IS_ROOT",
 				Value: strconv.FormatBool(options.IsValidator && options.IsRoot),
 			},
-		},
+		),
 		Command: []string{
 			"bash", "/mnt/scripts/start.sh",
 		},
@@ -256,9 +360,61 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 		VolumeMounts: volumeMounts,
 	}
 
+	// the pod with ordinal n runs the staker STAKER_OFFSET + n
+	if options.IsValidator {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name:  "STAKER_OFFSET",
+			Value: strconv.Itoa(int(stakerOffset(options))),
+		})
+	}
+
+	if !options.Probe.Disabled {
+		addProbes(&container, options.Probe)
+	}
+
 	return container
 }
 
+// addProbes lets the node only receive api traffic once it is bootstrapped
+// and restarts it if the api stops responding
+func addProbes(container *corev1.Container, probe version1.K8sProbe) {
+	bootstrapped := corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{
+			Command: []string{"bash", "/mnt/scripts/probe.sh"},
+		},
+	}
+
+	startupFailureThreshold := int32(probe.StartupTimeout / (PROBE_PERIOD_SECONDS * time.Second))
+	if startupFailureThreshold < 1 {
+		startupFailureThreshold = 1
+	}
+
+	container.StartupProbe = &corev1.Probe{
+		ProbeHandler:     bootstrapped,
+		TimeoutSeconds:   PROBE_TIMEOUT_SECONDS,
+		PeriodSeconds:    PROBE_PERIOD_SECONDS,
+		FailureThreshold: startupFailureThreshold,
+	}
+	container.ReadinessProbe = &corev1.Probe{
+		ProbeHandler:     bootstrapped,
+		TimeoutSeconds:   PROBE_TIMEOUT_SECONDS,
+		PeriodSeconds:    PROBE_PERIOD_SECONDS,
+		FailureThreshold: 3,
+	}
+	container.LivenessProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			// only checks that the node is responsive, the full /ext/health also fails if peers are missing
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: "/ext/health/liveness",
+				Port: intstr.FromString("rpc"),
+			},
+		},
+		TimeoutSeconds:   PROBE_TIMEOUT_SECONDS,
+		PeriodSeconds:    3 * PROBE_PERIOD_SECONDS,
+		FailureThreshold: 5,
+	}
+}
+
 func defaultVolumes(k8sConfig version1.K8sConfig) []corev1.Volume {
 
 	defaultMode := int32(0555)
@@ -280,10 +436,6 @@ func defaultVolumes(k8sConfig version1.K8sConfig) []corev1.Volume {
 				DefaultMode: &defaultMode,
 			},
 		}},
-		{
-			Name: "cert-vol", VolumeSource: corev1.VolumeSource{
-				EmptyDir: &corev1.EmptyDirVolumeSource{},
-			}},
 	}
 }
 
@@ -305,55 +457,53 @@ func defaultVolumeMounts() []corev1.VolumeMount {
 	}
 }
 
-func validatorInitContainer(options stateFullSetOptions) corev1.Container {
+// stakerOffset is the index of the staker the first pod of a role runs, the root node runs the first one
+func stakerOffset(options stateFullSetOptions) int32 {
+	if options.IsRoot {
+		return 0
+	}
+	return 1
+}
 
-	envs := []corev1.EnvVar{
-		{
-			Name: "NAMESPACE",
-			ValueFrom: &corev1.EnvVarSource{
-				FieldRef: &corev1.ObjectFieldSelector{
-					FieldPath: "metadata.namespace",
-				},
-			},
-		},
-		{
-			Name:  "SECRET_PREFIX",
-			Value: options.K8sPrefix,
-		},
+// stakersVolume projects the staker secrets into <index>/tls.crt, <index>/tls.key and <index>/node-id,
+// start.sh picks the one of its ordinal. The validators get all stakers of the network, so the volume
+// does not depend on the replicas and scaling them does not restart the running pods.
+func stakersVolume(options stateFullSetOptions) corev1.Volume {
+	last := stakerOffset(options) + options.Replicas
+	if !options.IsRoot && options.NumStakers > last {
+		last = options.NumStakers
 	}
 
-	if options.IsRoot {
-		envs = append(envs, corev1.EnvVar{
-			Name:  "IS_ROOT",
-			Value: "true",
+	sources := make([]corev1.VolumeProjection, 0, last-stakerOffset(options))
+	for index := stakerOffset(options); index < last; index++ {
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: fmt.Sprintf("%s-%d", options.K8sPrefix, index),
+				},
+				Items: []corev1.KeyToPath{
+					{Key: corev1.TLSCertKey, Path: fmt.Sprintf("%d/tls.crt", index)},
+					{Key: corev1.TLSPrivateKeyKey, Path: fmt.Sprintf("%d/tls.key", index)},
+					{Key: NODE_ID_KEY, Path: fmt.Sprintf("%d/node-id", index)},
+				},
+			},
 		})
 	}
 
-	return corev1.Container{
-		Name:  "init-certificates",
-		Image: "bitnami/kubectl:latest",
-		Env:   envs,
-		Command: []string{
-			"bash", "/mnt/scripts/init.sh",
-		},
-		VolumeMounts: append(defaultVolumeMounts(), corev1.VolumeMount{
-			Name:      "cert-vol",
-			MountPath: "/mnt/cert",
-			ReadOnly:  false,
-		}),
-	}
+	return corev1.Volume{
+		Name: "stakers-vol", VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: sources,
+			},
+		}}
 }
 
-func createServiceMonitor(ctx context.Context, restClient *rest.Config, options stateFullSetOptions) error {
-	promClientSet, err := promVersioned.NewForConfig(restClient)
-	if err != nil {
-		return err
-	}
-
-	sm := &promv1.ServiceMonitor{
+func buildServiceMonitor(options stateFullSetOptions) *promv1.ServiceMonitor {
+	return &promv1.ServiceMonitor{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   options.Name(),
-			Labels: options.Labels(),
+			Name:      options.Name(),
+			Namespace: options.Namespace,
+			Labels:    options.Labels(),
 		},
 		Spec: promv1.ServiceMonitorSpec{
 			JobLabel: options.Name(),
@@ -368,17 +518,4 @@ func createServiceMonitor(ctx context.Context, restClient *rest.Config, options
 			TargetLabels: []string{options.Name()},
 		},
 	}
-
-	client := promClientSet.MonitoringV1().ServiceMonitors(options.Namespace)
-
-	_, err = client.Get(ctx, sm.Name, metav1.GetOptions{})
-	if err == nil {
-		err := client.Delete(ctx, sm.Name, *metav1.NewDeleteOptions(0))
-		if err != nil {
-			return err
-		}
-	}
-
-	_, err = client.Create(ctx, sm, metav1.CreateOptions{})
-	return err
 }
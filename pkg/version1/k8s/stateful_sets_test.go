@@ -0,0 +1,116 @@
+/*
+ * stateful_sets_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chain4travel.com/camktncr/pkg/version1"
+)
+
+func stakerOptions(isRoot bool, replicas int32, numStakers int32) stateFullSetOptions {
+	nodeType := "validator"
+	if isRoot {
+		nodeType = "root"
+	}
+	return stateFullSetOptions{
+		K8sConfig:   version1.K8sConfig{K8sPrefix: "net", Namespace: "net", NumStakers: numStakers},
+		Type:        nodeType,
+		IsValidator: true,
+		IsRoot:      isRoot,
+		Replicas:    replicas,
+	}
+}
+
+func TestStakerOffset(t *testing.T) {
+	tests := []struct {
+		name    string
+		options stateFullSetOptions
+		want    int32
+	}{
+		{"root", stakerOptions(true, 1, 20), 0},
+		{"validators", stakerOptions(false, 4, 20), 1},
+		{"no validators", stakerOptions(false, 0, 20), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stakerOffset(tt.options); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStakersVolume(t *testing.T) {
+	tests := []struct {
+		name    string
+		options stateFullSetOptions
+		// the volume projects the stakers [first, last)
+		first int32
+		last  int32
+	}{
+		{"root only runs the first staker", stakerOptions(true, 1, 20), 0, 1},
+		{"validators get all other stakers", stakerOptions(false, 4, 20), 1, 20},
+		{"no validators yet", stakerOptions(false, 0, 20), 1, 20},
+		{"all stakers running", stakerOptions(false, 19, 20), 1, 20},
+		{"unknown number of stakers", stakerOptions(false, 4, 0), 1, 5},
+		{"more replicas than stakers", stakerOptions(false, 6, 5), 1, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume := stakersVolume(tt.options)
+			if volume.Projected == nil {
+				t.Fatalf("expected a projected volume, got %+v", volume.VolumeSource)
+			}
+
+			sources := volume.Projected.Sources
+			if int32(len(sources)) != tt.last-tt.first {
+				t.Fatalf("expected %d stakers, got %d", tt.last-tt.first, len(sources))
+			}
+			for i, source := range sources {
+				index := tt.first + int32(i)
+				if name := fmt.Sprintf("net-%d", index); source.Secret == nil || source.Secret.Name != name {
+					t.Fatalf("expected secret %s at %d, got %+v", name, i, source)
+				}
+				for _, item := range source.Secret.Items {
+					if dir := fmt.Sprintf("%d/", index); !strings.HasPrefix(item.Path, dir) {
+						t.Fatalf("expected %s to be in %s", item.Path, dir)
+					}
+				}
+			}
+		})
+	}
+}
+
+// scaling the validators must not change the pod template, otherwise the running pods are restarted
+func TestStakersVolumeDoesNotDependOnReplicas(t *testing.T) {
+	tests := []struct {
+		name string
+		from int32
+		to   int32
+	}{
+		{"scale up", 2, 4},
+		{"scale down", 4, 1},
+		{"scale to zero", 4, 0},
+		{"scale to all stakers", 1, 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := stakersVolume(stakerOptions(false, tt.from, 20))
+			after := stakersVolume(stakerOptions(false, tt.to, 20))
+			if !reflect.DeepEqual(before, after) {
+				t.Fatalf("the volume changed when scaling from %d to %d replicas", tt.from, tt.to)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+/*
+ * tls.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	TLS_CERT_MANAGER = "cert-manager"
+	TLS_SECRET       = "secret"
+	TLS_SELF_SIGNED  = "self-signed"
+	TLS_NONE         = "none"
+)
+
+var TLS_MODES = []string{TLS_CERT_MANAGER, TLS_SECRET, TLS_SELF_SIGNED, TLS_NONE}
+
+var ISSUER_KINDS = []string{"ClusterIssuer", "Issuer"}
+
+func ParseTLSMode(mode string) (string, error) {
+	return parseEnum("tls mode", mode, TLS_MODES)
+}
+
+func ParseIssuerKind(kind string) (string, error) {
+	return parseEnum("issuer kind", kind, ISSUER_KINDS)
+}
+
+// TLS_MODE_ANNOTATION records the tls mode of a network on its namespace
+const TLS_MODE_ANNOTATION = ANNOTATION_PREFIX + "tls-mode"
+
+const SELF_SIGNED_VALIDITY = 10 * 365 * 24 * time.Hour
+
+// tlsSecretName is the secret the ingress serves, empty for plain http
+func tlsSecretName(k8sConfig version1.K8sConfig) string {
+	switch k8sConfig.TLS.Mode {
+	case TLS_NONE:
+		return ""
+	case TLS_SECRET:
+		return k8sConfig.TLSSecretName
+	default:
+		return k8sConfig.PrefixWith("tls-secret")
+	}
+}
+
+// ingressAnnotations lets cert-manager issue the certificate of an Ingress
+func ingressAnnotations(k8sConfig version1.K8sConfig) map[string]string {
+	if k8sConfig.TLS.Mode != TLS_CERT_MANAGER {
+		return map[string]string{}
+	}
+	if k8sConfig.TLS.IssuerKind == "Issuer" {
+		return map[string]string{"cert-manager.io/issuer": k8sConfig.TLS.Issuer}
+	}
+	return map[string]string{"cert-manager.io/cluster-issuer": k8sConfig.TLS.Issuer}
+}
+
+// PublicURL is the base url the ingress publishes the network under
+func PublicURL(k8sConfig version1.K8sConfig) string {
+	scheme := "https"
+	if k8sConfig.TLS.Mode == TLS_NONE {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s", scheme, publicHost(k8sConfig))
+}
+
+// LoadTLSMode reads the tls mode a network was created with, networks created before it was recorded use cert-manager
+func LoadTLSMode(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (string, error) {
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	mode, ok := namespace.Annotations[TLS_MODE_ANNOTATION]
+	if !ok || mode == "" {
+		return TLS_CERT_MANAGER, nil
+	}
+	return mode, nil
+}
+
+// publicClient is the http client for the public url, it trusts the ca of a self-signed network
+func publicClient(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig) (*http.Client, error) {
+	client := &http.Client{Timeout: CONNECTION_TIMEOUT}
+	if k8sConfig.TLS.Mode != TLS_SELF_SIGNED {
+		return client, nil
+	}
+
+	clientset, err := kubernetes.NewForConfig(restClient)
+	if err != nil {
+		return nil, err
+	}
+	caSecret, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).Get(ctx, caSecretName(k8sConfig), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not load the ca of the self-signed certificate: %w", err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(caSecret.Data[corev1.TLSCertKey]) {
+		return nil, fmt.Errorf("invalid ca in secret %s", caSecret.Name)
+	}
+	client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}
+	return client, nil
+}
+
+func caSecretName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("ca")
+}
+
+// CreateSelfSignedCertificate generates a ca and a certificate for the public host of the network and returns the ca in pem.
+// Both are kept once they exist, so running create again does not invalidate a ca that clients already trust.
+func CreateSelfSignedCertificate(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) ([]byte, error) {
+	secrets := clientset.CoreV1().Secrets(k8sConfig.Namespace)
+
+	caSecret, err := secrets.Get(ctx, caSecretName(k8sConfig), metav1.GetOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		_, err = secrets.Get(ctx, tlsSecretName(k8sConfig), metav1.GetOptions{})
+		if err == nil {
+			return caSecret.Data[corev1.TLSCertKey], nil
+		}
+		if !k8sErrors.IsNotFound(err) {
+			return nil, err
+		}
+		caSecret = buildTLSSecret(k8sConfig, caSecret.Name, caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey])
+	} else {
+		caSecret, err = generateCA(k8sConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ca, err := tls.X509KeyPair(caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ca in secret %s: %w", caSecretName(k8sConfig), err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err := generateCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: publicHost(k8sConfig)},
+		DNSNames:    []string{publicHost(k8sConfig)},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, caCert, ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyObjects(ctx, restClient, caSecret, buildTLSSecret(k8sConfig, tlsSecretName(k8sConfig), certPEM, keyPEM))
+	if err != nil {
+		return nil, err
+	}
+	return caSecret.Data[corev1.TLSCertKey], nil
+}
+
+func generateCA(k8sConfig version1.K8sConfig) (*corev1.Secret, error) {
+	certPEM, keyPEM, err := generateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("%s camktncr ca", k8sConfig.K8sPrefix)},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return buildTLSSecret(k8sConfig, caSecretName(k8sConfig), certPEM, keyPEM), nil
+}
+
+// generateCertificate signs template with a new key, it is self signed if parent is nil
+func generateCertificate(template *x509.Certificate, parent *x509.Certificate, parentKey interface{}) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(SELF_SIGNED_VALIDITY)
+
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM, nil
+}
+
+func buildTLSSecret(k8sConfig version1.K8sConfig, name string, certPEM []byte, keyPEM []byte) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * ttl.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const EXPIRES_AT_ANNOTATION = ANNOTATION_PREFIX + "expires-at"
+
+// GetExpiry returns when the network expires, found is false if it never does
+func GetExpiry(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (time.Time, bool, error) {
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return parseExpiry(namespace.Annotations)
+}
+
+func parseExpiry(annotations map[string]string) (time.Time, bool, error) {
+	raw, ok := annotations[EXPIRES_AT_ANNOTATION]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s annotation '%s': %w", EXPIRES_AT_ANNOTATION, raw, err)
+	}
+	return expiresAt, true, nil
+}
+
+// SetExpiry records when the network may be garbage collected.
+// It is patched instead of applied so re-applying the namespace does not drop it.
+func SetExpiry(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, expiresAt time.Time) error {
+	return patchNamespaceAnnotation(ctx, clientset, k8sConfig, EXPIRES_AT_ANNOTATION, expiresAt.UTC().Format(time.RFC3339))
+}
+
+// patchNamespaceAnnotation sets a single annotation of the network namespace, nil removes it
+func patchNamespaceAnnotation(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, key string, value interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				key: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Namespaces().Patch(ctx, k8sConfig.Namespace, types.MergePatchType, patch, metav1.PatchOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+// ClearExpiry removes the expiry so the network is never garbage collected
+func ClearExpiry(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	return patchNamespaceAnnotation(ctx, clientset, k8sConfig, EXPIRES_AT_ANNOTATION, nil)
+}
+
+// Expired returns the networks whose expiry lies before now
+func Expired(networks []NetworkInfo, now time.Time) []NetworkInfo {
+	expired := []NetworkInfo{}
+	for _, n := range networks {
+		if n.ExpiresAt != nil && n.ExpiresAt.Before(now) {
+			expired = append(expired, n)
+		}
+	}
+	return expired
+}
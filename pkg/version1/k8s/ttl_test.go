@@ -0,0 +1,77 @@
+/*
+ * ttl_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        time.Time
+		wantFound   bool
+		wantErr     bool
+	}{
+		{"no annotations", nil, time.Time{}, false, false},
+		{"other annotations", map[string]string{CREATOR_ANNOTATION: "alice"}, time.Time{}, false, false},
+		{"utc", map[string]string{EXPIRES_AT_ANNOTATION: "2022-11-01T12:00:00Z"}, time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC), true, false},
+		{"offset", map[string]string{EXPIRES_AT_ANNOTATION: "2022-11-01T14:00:00+02:00"}, time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC), true, false},
+		{"empty", map[string]string{EXPIRES_AT_ANNOTATION: ""}, time.Time{}, false, true},
+		{"not rfc3339", map[string]string{EXPIRES_AT_ANNOTATION: "2022-11-01 12:00"}, time.Time{}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found, err := parseExpiry(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if found != tt.wantFound || !got.Equal(tt.want) {
+				t.Fatalf("expected %s (found %v), got %s (found %v)", tt.want, tt.wantFound, got, found)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Minute)
+	after := now.Add(time.Minute)
+
+	networks := []NetworkInfo{
+		{Name: "never"},
+		{Name: "expired", ExpiresAt: &before},
+		{Name: "running", ExpiresAt: &after},
+		{Name: "now", ExpiresAt: &now},
+	}
+
+	tests := []struct {
+		name     string
+		networks []NetworkInfo
+		want     []string
+	}{
+		{"none", nil, []string{}},
+		{"mixed", networks, []string{"expired"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Expired(tt.networks, now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i].Name != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
@@ -16,6 +16,11 @@ const (
 	NODE_ID_KEY = "Node-ID"
 )
 
+const (
+	MANAGED_BY_LABEL = "app.kubernetes.io/managed-by"
+	MANAGED_BY_VALUE = "camktncr"
+)
+
 type stateFullSetOptions struct {
 	version1.K8sConfig
 	Type        string
@@ -23,6 +28,10 @@ type stateFullSetOptions struct {
 	IsRoot      bool
 	Replicas    int32
 	Requests    corev1.ResourceList
+	Limits      corev1.ResourceList
+	Probe       version1.K8sProbe
+	Storage     version1.K8sStorage
+	Scheduling  version1.K8sScheduling
 }
 
 func (s stateFullSetOptions) Name() string {
@@ -30,7 +39,11 @@ func (s stateFullSetOptions) Name() string {
 }
 
 func (s stateFullSetOptions) Labels() map[string]string {
-	labels := s.K8sConfig.Labels
+	// copy so the labels of the network itself are not changed
+	labels := make(map[string]string, len(s.K8sConfig.Labels)+1)
+	for k, v := range s.K8sConfig.Labels {
+		labels[k] = v
+	}
 	labels["type"] = s.Type
 	return labels
 }
@@ -1,92 +1,60 @@
 package k8s
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
+	"chain4travel.com/camktncr/pkg/logging"
+	"chain4travel.com/camktncr/pkg/progress"
 	"chain4travel.com/camktncr/pkg/version1"
+	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
 )
 
 const DEFAULT_PENDING_TIME_OFFSET = 2 * time.Minute
 const SYNC_BOUND = time.Minute
+const REGISTRATION_PHASE = "registration"
 
-func RegisterValidators(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, stakers []version1.Staker, allowError bool) error {
-	roundTripper, upgrader, err := spdy.RoundTripperFor(restClient)
-	if err != nil {
-		return err
-	}
-
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", k8sConfig.Namespace, fmt.Sprintf("%s-root-0", k8sConfig.K8sPrefix))
-	hostIP := strings.TrimLeft(restClient.Host, "htps:/")
-	serverURL := url.URL{Scheme: "https", Path: path, Host: hostIP}
-
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, &serverURL)
-
-	stopChan, readyChan := make(chan struct{}, 1), make(chan struct{}, 1)
-	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
-
-	forwarder, err := portforward.New(dialer, []string{"9650"}, stopChan, readyChan, out, errOut)
-	if err != nil {
-		return err
-	}
-
-	go func() {
-		for range readyChan { // Kubernetes will close this channel when it has something to tell us.
-		}
-		if len(errOut.String()) != 0 {
-			panic(errOut.String())
-		} else if len(out.String()) != 0 {
-			fmt.Println(out.String())
-		}
-	}()
+func registrationLogger(staker version1.Staker) *zap.Logger {
+	return zap.L().With(logging.Phase(REGISTRATION_PHASE), logging.NodeID(staker.NodeID))
+}
 
-	go func() {
-		if err = forwarder.ForwardPorts(); err != nil { // Locks until stopChan is closed.
-			fmt.Println(err)
-		}
-	}()
-	time.Sleep(1 * time.Second) // waiting for the connection to open kinda hacky ngl
-	defer close(stopChan)
+// RegisterValidators adds the stakers as validators, progress is reported as one step per staker of phase (which may be nil)
+func RegisterValidators(ctx context.Context, conn *NodeConnection, stakers []version1.Staker, allowError bool, phase *progress.Phase) error {
 
 	for {
-		err := isBootstrapped()
+		err := isBootstrapped(ctx, conn)
 		if err != nil {
-			log.Println("root has not bootstrapped yet")
+			zap.L().Info("root has not bootstrapped yet", logging.Phase(REGISTRATION_PHASE), zap.Error(err))
 		} else {
 			break
 		}
-		time.Sleep(DEFAULT_TIMEOUT)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("could not wait for root to bootstrap: %v", ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
 	}
 
 	g, ctx := errgroup.WithContext(ctx)
 
 	for _, staker := range stakers {
+		staker := staker
+		step := phase.Step(staker.NodeID.String())
 		g.Go(func() error {
-			err := registerValidator(ctx, staker, allowError)
-			if err != nil {
-				return err
-			}
-			return nil
+			return step.Done(registerValidator(ctx, conn, staker, allowError))
 		})
 		time.Sleep(1 * time.Second)
 	}
 
-	err = g.Wait()
+	err := g.Wait()
 	if err != nil {
 		return err
 	}
@@ -106,7 +74,7 @@ type ResultResp struct {
 
 var errNotAddedToMempool = errors.New("tx was not added to mempool")
 
-func verifyStatus(ctx context.Context, staker version1.Staker, txId string) error {
+func verifyStatus(ctx context.Context, conn *NodeConnection, staker version1.Staker, txId string) error {
 
 	for {
 		select {
@@ -123,17 +91,13 @@ func verifyStatus(ctx context.Context, staker version1.Staker, txId string) erro
 				}
 			}`, txId))
 
-			res, err := http.Post("http://localhost:9650/ext/bc/P", "application/json", getTxStatusPayload)
+			body, err := conn.Post(ctx, "/ext/bc/P", getTxStatusPayload)
 			if err != nil {
 				return err
 			}
 
-			body, err := ioutil.ReadAll(res.Body)
-			if err != nil {
-				return err
-			}
-
-			fmt.Println(string(body))
+			logger := registrationLogger(staker)
+			logger.Debug("platform.getTxStatus response", zap.ByteString("body", body))
 
 			var txStatus ResultResp
 			err = json.Unmarshal(body, &txStatus)
@@ -141,7 +105,7 @@ func verifyStatus(ctx context.Context, staker version1.Staker, txId string) erro
 				return err
 			}
 
-			fmt.Printf("%s: TXID %s Status: %s\n", staker.NodeID, txId, txStatus.Result.Status)
+			logger.Info("tx status", zap.String("txID", txId), zap.String("status", txStatus.Result.Status))
 
 			switch txStatus.Result.Status {
 			case "Committed":
@@ -155,14 +119,14 @@ func verifyStatus(ctx context.Context, staker version1.Staker, txId string) erro
 	}
 }
 
-func waitForValidatorToBecomeActive(ctx context.Context, staker version1.Staker) error {
+func waitForValidatorToBecomeActive(ctx context.Context, conn *NodeConnection, staker version1.Staker) error {
 	for {
 
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("could not wait for validator %s to become active. Reason: %v", staker.NodeID, ctx.Err())
 		default:
-			active, err := isActiveValidator(staker)
+			active, err := isActiveValidator(ctx, conn, staker)
 			if err != nil {
 				return err
 			}
@@ -171,7 +135,7 @@ func waitForValidatorToBecomeActive(ctx context.Context, staker version1.Staker)
 				return nil
 			}
 
-			fmt.Printf("validator %s not active yet\n", staker.NodeID)
+			registrationLogger(staker).Info("validator not active yet")
 			time.Sleep(DEFAULT_PENDING_TIME_OFFSET / 10)
 
 		}
@@ -179,7 +143,7 @@ func waitForValidatorToBecomeActive(ctx context.Context, staker version1.Staker)
 	}
 }
 
-func isActiveValidator(staker version1.Staker) (bool, error) {
+func isActiveValidator(ctx context.Context, conn *NodeConnection, staker version1.Staker) (bool, error) {
 	getCurrentValidatorsPayload := strings.NewReader(`{
 			"jsonrpc": "2.0",
 			"method": "platform.getCurrentValidators",
@@ -190,12 +154,7 @@ func isActiveValidator(staker version1.Staker) (bool, error) {
 			"id": 1
 		}`)
 
-	res, err := http.Post("http://localhost:9650/ext/bc/P", "application/json", getCurrentValidatorsPayload)
-	if err != nil {
-		return false, err
-	}
-
-	body, err := ioutil.ReadAll(res.Body)
+	body, err := conn.Post(ctx, "/ext/bc/P", getCurrentValidatorsPayload)
 	if err != nil {
 		return false, err
 	}
@@ -208,7 +167,7 @@ func isActiveValidator(staker version1.Staker) (bool, error) {
 
 }
 
-func isPendingValidator(staker version1.Staker) (bool, error) {
+func isPendingValidator(ctx context.Context, conn *NodeConnection, staker version1.Staker) (bool, error) {
 	getPendingValidatorsPayload := strings.NewReader(`{
 			"jsonrpc": "2.0",
 			"method": "platform.getPendingValidators",
@@ -219,12 +178,7 @@ func isPendingValidator(staker version1.Staker) (bool, error) {
 			"id": 1
 		}`)
 
-	res, err := http.Post("http://localhost:9650/ext/bc/P", "application/json", getPendingValidatorsPayload)
-	if err != nil {
-		return false, err
-	}
-
-	body, err := ioutil.ReadAll(res.Body)
+	body, err := conn.Post(ctx, "/ext/bc/P", getPendingValidatorsPayload)
 	if err != nil {
 		return false, err
 	}
@@ -237,7 +191,7 @@ func isPendingValidator(staker version1.Staker) (bool, error) {
 
 }
 
-func registerValidator(ctx context.Context, staker version1.Staker, allowError bool) error {
+func registerValidator(ctx context.Context, conn *NodeConnection, staker version1.Staker, allowError bool) error {
 	day, err := time.ParseDuration("24h")
 	if err != nil {
 		return err
@@ -248,6 +202,7 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 	sum := sha1.Sum([]byte(username))
 	password := hex.EncodeToString(sum[:])
 	addr := fmt.Sprintf("P-%s", strings.Split(staker.PublicAddress, "-")[1])
+	logger := registrationLogger(staker)
 
 	createUserPostData := strings.NewReader(fmt.Sprintf(`{
 			"jsonrpc":"2.0",
@@ -258,17 +213,12 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 				"password": "%s"
 			}
 		}`, username, password))
-	res, err := http.Post("http://localhost:9650/ext/keystore", "application/json", createUserPostData)
+	body, err := conn.Post(ctx, "/ext/keystore", createUserPostData)
 	if err != nil {
 		return err
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return err
-	}
-
-	fmt.Println(string(body))
+	logger.Debug("keystore.createUser response", zap.ByteString("body", body))
 
 	importKeyPostData := strings.NewReader(fmt.Sprintf(`{
 			"jsonrpc":"2.0",
@@ -280,17 +230,12 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 				"privateKey":"%s"
 			}
 		}`, username, password, staker.PrivateKey))
-	res, err = http.Post("http://localhost:9650/ext/bc/P", "application/json", importKeyPostData)
+	body, err = conn.Post(ctx, "/ext/bc/P", importKeyPostData)
 	if err != nil {
 		return err
 	}
 
-	body, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		return err
-	}
-
-	fmt.Println(string(body))
+	logger.Debug("platform.importKey response", zap.ByteString("body", body))
 
 	count := 0
 	startTime := time.Now().Add(DEFAULT_PENDING_TIME_OFFSET + SYNC_BOUND)
@@ -298,9 +243,9 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 
 	for {
 		count++
-		fmt.Printf("Attempt %d: %s\n", count, staker.NodeID)
+		logger.Info("registering validator", zap.Int("attempt", count))
 
-		active, err := isActiveValidator(staker)
+		active, err := isActiveValidator(ctx, conn, staker)
 		if err != nil {
 			return err
 		}
@@ -309,13 +254,13 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 			return nil
 		}
 
-		pending, err := isPendingValidator(staker)
+		pending, err := isPendingValidator(ctx, conn, staker)
 		if err != nil {
 			return err
 		}
 
 		if pending {
-			return waitForValidatorToBecomeActive(ctx, staker)
+			return waitForValidatorToBecomeActive(ctx, conn, staker)
 		}
 
 		select {
@@ -323,10 +268,10 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 			return fmt.Errorf("could not add %s as a validator: %v", staker.NodeID, ctx.Err())
 		default:
 			if time.Now().After(startTime) {
-				fmt.Println("XXXXXX")
+				logger.Debug("start time passed before the validator was added, moving it")
 				startTime = time.Now().Add(DEFAULT_PENDING_TIME_OFFSET + SYNC_BOUND)
 			}
-			addVaidatorPostData := strings.NewReader(fmt.Sprintf(`{
+			addValidatorPayload := fmt.Sprintf(`{
 			"jsonrpc":"2.0",
 			"id"     :1,
 			"method": "platform.addValidator",
@@ -340,17 +285,14 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 				"username": "%s",
 				"password": "%s"
 			}
-		}`, staker.NodeID.String(), startTime.Unix(), endTime.Unix(), staker.Stake, addr, username, password))
-			println(addVaidatorPostData)
-			res, err = http.Post("http://localhost:9650/ext/bc/P", "application/json", addVaidatorPostData)
+		}`, staker.NodeID.String(), startTime.Unix(), endTime.Unix(), staker.Stake, addr, username, password)
+			logger.Debug("platform.addValidator request", zap.Time("startTime", startTime), zap.Time("endTime", endTime), zap.Uint64("stake", staker.Stake))
+			body, err = conn.Post(ctx, "/ext/bc/P", strings.NewReader(addValidatorPayload))
 			if err != nil {
 				return err
 			}
 
-			body, err = ioutil.ReadAll(res.Body)
-			if err != nil {
-				return err
-			}
+			logger.Debug("platform.addValidator response", zap.ByteString("body", body))
 
 			var result ResultResp
 			err = json.Unmarshal(body, &result)
@@ -362,7 +304,7 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 			err = fmt.Errorf("failed to add validator %s - Reason: %s", staker.NodeID, result.Error.Message)
 			if txId == "" {
 				if allowError {
-					fmt.Println("Ignoring error:", err)
+					logger.Warn("ignoring error", zap.Error(err))
 					time.Sleep(DEFAULT_TIMEOUT)
 					continue
 				} else {
@@ -372,7 +314,7 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 
 			time.Sleep(DEFAULT_TIMEOUT)
 
-			err = verifyStatus(ctx, staker, txId)
+			err = verifyStatus(ctx, conn, staker, txId)
 			if err != nil {
 				if err == errNotAddedToMempool {
 					continue
@@ -382,7 +324,7 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 
 			time.Sleep(DEFAULT_TIMEOUT)
 
-			err = waitForValidatorToBecomeActive(ctx, staker)
+			err = waitForValidatorToBecomeActive(ctx, conn, staker)
 			if err != nil {
 				return err
 			}
@@ -394,45 +336,35 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 
 }
 
-func isBootstrapped() error {
-	url := "http://localhost:9650/ext/info"
-	method := "POST"
+func isBootstrapped(ctx context.Context, conn *NodeConnection) error {
+	return isChainBootstrapped(ctx, conn, "P")
+}
 
-	payload := strings.NewReader(`{
+func isChainBootstrapped(ctx context.Context, conn *NodeConnection, chain string) error {
+	payload := strings.NewReader(fmt.Sprintf(`{
     "jsonrpc":"2.0",
     "id"     :1,
     "method" :"info.isBootstrapped",
     "params": {
-        "chain": "P"
+        "chain": "%s"
     }
-}`)
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, payload)
+}`, chain))
 
+	body, err := conn.Post(ctx, "/ext/info", payload)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Content-Type", "application/json")
 
-	res, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	parsed := make(map[string]interface{})
 
-	body, err := ioutil.ReadAll(res.Body)
+	err = json.Unmarshal(body, &parsed)
 	if err != nil {
 		return err
 	}
 
-	parsed := make(map[string]interface{})
-
-	json.Unmarshal(body, &parsed)
-
-	result := parsed["result"].(map[string]interface{})
-
-	if result["isBootstrapped"] != true {
-		return fmt.Errorf("not bootstrapped yet")
+	result, ok := parsed["result"].(map[string]interface{})
+	if !ok || result["isBootstrapped"] != true {
+		return fmt.Errorf("%s chain has not bootstrapped yet", chain)
 	}
 
 	return nil
@@ -7,6 +7,7 @@
 package version1
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -80,17 +81,7 @@ func createStakers(config NetworkConfig) ([]Staker, error) {
 	factory := crypto.FactorySECP256K1R{}
 	for i := 0; i < int(config.NumStakers); i++ {
 
-		CertBytes, KeyBytes, err := staking.NewCertAndKeyBytes()
-		if err != nil {
-			return nil, err
-		}
-
-		cert, err := staking.LoadTLSCertFromBytes(KeyBytes, CertBytes)
-		if err != nil {
-			return nil, err
-		}
-
-		nodeID, err := peer.CertToID(cert.Leaf)
+		nodeID, cert, CertBytes, KeyBytes, err := NewStakingCertificate()
 		if err != nil {
 			return nil, err
 		}
@@ -135,6 +126,26 @@ func createStakers(config NetworkConfig) ([]Staker, error) {
 	return stakers, nil
 }
 
+// NewStakingCertificate generates the staking tls certificate of a node and returns it together with the node id derived from it
+func NewStakingCertificate() (ids.NodeID, *tls.Certificate, []byte, []byte, error) {
+	certBytes, keyBytes, err := staking.NewCertAndKeyBytes()
+	if err != nil {
+		return ids.NodeID{}, nil, nil, nil, err
+	}
+
+	cert, err := staking.LoadTLSCertFromBytes(keyBytes, certBytes)
+	if err != nil {
+		return ids.NodeID{}, nil, nil, nil, err
+	}
+
+	nodeID, err := peer.CertToID(cert.Leaf)
+	if err != nil {
+		return ids.NodeID{}, nil, nil, nil, err
+	}
+
+	return nodeID, cert, certBytes, keyBytes, nil
+}
+
 // PublicKeyToEthAddress returns the ethereum address derived from [pubKey]
 func PublicKeyToEthAddress(pubKey *crypto.PublicKeySECP256K1R) common.Address {
 	return ethcrypto.PubkeyToAddress(*(pubKey.ToECDSA()))
@@ -152,7 +163,7 @@ func BuildNetwork(config NetworkConfig, now uint64) (*Network, error) {
 	genesisConfig := BuildGenesisConfig(allocations, now, stakersRaw[:config.NumInitialStakers], config.NetworkName)
 
 	return &Network{
-		pkg.Commit,
+		pkg.Commit(),
 		genesisConfig, stakersRaw,
 	}, nil
 }
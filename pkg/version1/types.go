@@ -9,10 +9,12 @@ package version1
 import (
 	"crypto/tls"
 	"fmt"
+	"time"
 
 	"github.com/ava-labs/avalanchego/genesis"
 	"github.com/ava-labs/avalanchego/ids"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -38,6 +40,117 @@ type NetworkConfig struct {
 type K8sResources struct {
 	Api       corev1.ResourceList
 	Validator corev1.ResourceList
+	// limits are not set if empty
+	ApiLimits       corev1.ResourceList
+	ValidatorLimits corev1.ResourceList
+	Storage         K8sStorages
+}
+
+type K8sStorage struct {
+	// Ephemeral keeps the node data in an emptyDir, it is lost whenever the pod is replaced
+	Ephemeral bool
+	Size      resource.Quantity
+	// StorageClass of the data volume, the cluster default if empty
+	StorageClass string
+}
+
+type K8sStorages struct {
+	Root      K8sStorage
+	Validator K8sStorage
+	Api       K8sStorage
+}
+
+// ForRole returns the storage of a node role (root, validator or api)
+func (s K8sStorages) ForRole(role string) K8sStorage {
+	switch role {
+	case "root":
+		return s.Root
+	case "api":
+		return s.Api
+	default:
+		return s.Validator
+	}
+}
+
+type K8sProbe struct {
+	Disabled bool
+	// StartupTimeout is how long a node may take to bootstrap before it is restarted
+	StartupTimeout time.Duration
+}
+
+type K8sProbes struct {
+	Root      K8sProbe
+	Validator K8sProbe
+	Api       K8sProbe
+}
+
+const (
+	ANTI_AFFINITY_NONE      = "none"
+	ANTI_AFFINITY_PREFERRED = "preferred"
+	ANTI_AFFINITY_REQUIRED  = "required"
+)
+
+type K8sScheduling struct {
+	NodeSelector map[string]string
+	Tolerations  []corev1.Toleration
+	// AntiAffinity spreads the pods of the role over TopologyKey, preferred still co-locates them if there is no room
+	AntiAffinity string
+	TopologyKey  string
+}
+
+type K8sSchedulings struct {
+	Root      K8sScheduling
+	Validator K8sScheduling
+	Api       K8sScheduling
+}
+
+type K8sIngress struct {
+	// Provider is nginx, traefik or gateway
+	Provider  string
+	ClassName string
+	// EntryPoints of traefik the IngressRoute listens on
+	EntryPoints []string
+	// Gateway the HTTPRoute is attached to
+	GatewayName      string
+	GatewayNamespace string
+	GatewaySection   string
+}
+
+type K8sTLS struct {
+	// Mode is cert-manager, secret, self-signed or none
+	Mode string
+	// Issuer of cert-manager, IssuerKind is Issuer or ClusterIssuer
+	Issuer     string
+	IssuerKind string
+}
+
+type K8sExposure struct {
+	// NodeRoutes publishes every node under /nodes/<node>/ of the public endpoint
+	NodeRoutes bool
+	// Staking exposes the staking port of the validators: none, loadbalancer or nodeport
+	Staking            string
+	StakingAnnotations map[string]string
+}
+
+type K8sNodeConfigs struct {
+	// camino-node flags of a role, they replace the defaults in the config.json of the role
+	Root      map[string]interface{}
+	Validator map[string]interface{}
+	Api       map[string]interface{}
+	// CChain is the config.json of the C-chain, there is none if empty
+	CChain []byte
+}
+
+// ForRole returns the flags of a node role (root, validator or api)
+func (c K8sNodeConfigs) ForRole(role string) map[string]interface{} {
+	switch role {
+	case "root":
+		return c.Root
+	case "api":
+		return c.Api
+	default:
+		return c.Validator
+	}
 }
 
 type K8sConfig struct {
@@ -49,7 +162,18 @@ type K8sConfig struct {
 	TLSSecretName    string
 	PullSecretName   string
 	Resources        K8sResources
+	Probes           K8sProbes
+	Scheduling       K8sSchedulings
+	Ingress          K8sIngress
+	TLS              K8sTLS
+	Exposure         K8sExposure
+	NodeConfig       K8sNodeConfigs
 	EnableMonitoring bool
+
+	// BootstrapNodes is the number of validators (root-0 first) all nodes bootstrap from
+	BootstrapNodes int32
+	// NumStakers is the number of staker secrets of the network, the validators project all of them
+	NumStakers int32
 }
 
 func (k K8sConfig) PrefixWith(s string) string {